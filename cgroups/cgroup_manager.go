@@ -1,10 +1,34 @@
 package cgroups
 
 import (
+	"fmt"
 	"github.com/xianlubird/mydocker/cgroups/subsystems"
 	"github.com/Sirupsen/logrus"
+	"path"
+	"strings"
 )
 
+// 容器的 cgroup 默认都创建在这个父 cgroup 下, 父 cgroup 上的限制对其中所有的容器生效
+const DefaultCgroupParent = "/mydocker"
+
+// 父 cgroup 是相对于 hierarchy 根目录的路径, 不能包含 ..
+func ValidateCgroupParent(parent string) error {
+	for _, name := range strings.Split(parent, "/") {
+		if name == ".." {
+			return fmt.Errorf("invalid cgroup parent %s, should not contain ..", parent)
+		}
+	}
+	return nil
+}
+
+// 容器的 cgroup 路径为 <parent>/<id>, parent 为空时使用默认的父 cgroup
+func ContainerCgroupPath(parent, id string) string {
+	if parent == "" {
+		parent = DefaultCgroupParent
+	}
+	return strings.TrimPrefix(path.Join("/", parent, id), "/")
+}
+
 type CgroupManager struct {
 	// cgroup在hierarchy中的路径 相当于创建的cgroup目录相对于root cgroup目录的路径
 	Path     string
@@ -20,22 +44,65 @@ func NewCgroupManager(path string) *CgroupManager {
 
 // 将进程pid加入到这个cgroup中
 func (c *CgroupManager) Apply(pid int) error {
+	if subsystems.IsCgroup2UnifiedMode() {
+		return c.applyUnified(pid)
+	}
 	for _, subSysIns := range(subsystems.SubsystemsIns) {
-		subSysIns.Apply(c.Path, pid)
+		if err := subSysIns.Apply(c.Path, pid); err != nil {
+			return fmt.Errorf("apply %s cgroup error %v", subSysIns.Name(), err)
+		}
 	}
 	return nil
 }
 
-// 设置cgroup资源限制
+// 设置cgroup资源限制, 也用于修改运行中容器的限制, 任何一个 subsystem 设置失败都返回错误
 func (c *CgroupManager) Set(res *subsystems.ResourceConfig) error {
+	// v2 需要先在父目录中开启控制器, 各个 subsystem 再写入 v2 的接口文件
+	if subsystems.IsCgroup2UnifiedMode() {
+		if err := c.createUnified(); err != nil {
+			return err
+		}
+	}
 	for _, subSysIns := range(subsystems.SubsystemsIns) {
-		subSysIns.Set(c.Path, res)
+		if err := subSysIns.Set(c.Path, res); err != nil {
+			return fmt.Errorf("set %s cgroup error %v", subSysIns.Name(), err)
+		}
 	}
 	return nil
 }
 
+// 获取 cgroup 的资源使用情况
+func (c *CgroupManager) GetStats() (*subsystems.Stats, error) {
+	stats := &subsystems.Stats{}
+	for _, subSysIns := range subsystems.SubsystemsIns {
+		if statsIns, ok := subSysIns.(subsystems.StatsSubsystem); ok {
+			if err := statsIns.GetStats(c.Path, stats); err != nil {
+				return nil, fmt.Errorf("get %s stats error %v", subSysIns.Name(), err)
+			}
+		}
+	}
+	return stats, nil
+}
+
+// 监听 cgroup 中的 OOM 事件
+func (c *CgroupManager) NotifyOOM() (<-chan struct{}, error) {
+	return subsystems.NotifyOOM(c.Path)
+}
+
+// cgroup 中发生过 OOM kill 时返回 true
+func (c *CgroupManager) OOMKilled() bool {
+	count, err := subsystems.OOMKillCount(c.Path)
+	return err == nil && count > 0
+}
+
 //释放cgroup
 func (c *CgroupManager) Destroy() error {
+	if subsystems.IsCgroup2UnifiedMode() {
+		if err := c.destroyUnified(); err != nil {
+			logrus.Warnf("%v", err)
+		}
+		return nil
+	}
 	for _, subSysIns := range(subsystems.SubsystemsIns) {
 		if err := subSysIns.Remove(c.Path); err != nil {
 			logrus.Warnf("remove cgroup fail %v", err)
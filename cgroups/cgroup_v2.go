@@ -0,0 +1,64 @@
+package cgroups
+
+import (
+	"fmt"
+	"github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/cgroups/subsystems"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// cgroup v2 中所有控制器共用一个目录
+func (c *CgroupManager) unifiedPath() string {
+	return path.Join(subsystems.UnifiedMountpoint, c.Path)
+}
+
+// 逐级创建 cgroup 目录, 并在每一级父目录的 cgroup.subtree_control 中开启控制器, 子目录中才会出现 memory.max 等接口文件
+func (c *CgroupManager) createUnified() error {
+	dir := subsystems.UnifiedMountpoint
+	for _, name := range strings.Split(c.Path, "/") {
+		if name == "" {
+			continue
+		}
+		enableControllers(dir)
+		dir = path.Join(dir, name)
+		if err := os.Mkdir(dir, 0755); err != nil && !os.IsExist(err) {
+			return fmt.Errorf("error create cgroup %v", err)
+		}
+	}
+	return nil
+}
+
+func enableControllers(dir string) {
+	content, err := ioutil.ReadFile(path.Join(dir, "cgroup.controllers"))
+	if err != nil {
+		logrus.Warnf("read cgroup controllers of %s fail %v", dir, err)
+		return
+	}
+	// 逐个开启, 某个控制器开启失败只影响对应的限制
+	for _, controller := range strings.Fields(string(content)) {
+		if err := ioutil.WriteFile(path.Join(dir, "cgroup.subtree_control"), []byte("+"+controller), 0644); err != nil {
+			logrus.Warnf("enable cgroup controller %s in %s fail %v", controller, dir, err)
+		}
+	}
+}
+
+func (c *CgroupManager) applyUnified(pid int) error {
+	if err := c.createUnified(); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(path.Join(c.unifiedPath(), "cgroup.procs"), []byte(strconv.Itoa(pid)), 0644); err != nil {
+		return fmt.Errorf("set cgroup proc fail %v", err)
+	}
+	return nil
+}
+
+func (c *CgroupManager) destroyUnified() error {
+	if err := os.Remove(c.unifiedPath()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("remove cgroup fail %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,346 @@
+package subsystems
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// blkio.weight 的取值范围, 0 表示不设置
+const (
+	MinBlkioWeight = 10
+	MaxBlkioWeight = 1000
+)
+
+// 块设备的权重, 对应 blkio.weight_device 中的 "major:minor weight"
+type WeightDevice struct {
+	Major  int64  `json:"major"`
+	Minor  int64  `json:"minor"`
+	Weight uint16 `json:"weight"`
+}
+
+func (d WeightDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", d.Major, d.Minor, d.Weight)
+}
+
+// 块设备的读写限制, 对应 blkio.throttle.*_device 中的 "major:minor rate", bps 的单位是字节每秒
+type ThrottleDevice struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Rate  uint64 `json:"rate"`
+}
+
+func (d ThrottleDevice) String() string {
+	return fmt.Sprintf("%d:%d %d", d.Major, d.Minor, d.Rate)
+}
+
+func ValidateBlkioWeight(weight int) error {
+	if weight != 0 && (weight < MinBlkioWeight || weight > MaxBlkioWeight) {
+		return fmt.Errorf("invalid blkio weight %d, should be in range [%d, %d]", weight, MinBlkioWeight, MaxBlkioWeight)
+	}
+	return nil
+}
+
+// 获取块设备的设备号
+func blockDeviceNumber(devicePath string) (int64, int64, error) {
+	var stat syscall.Stat_t
+	if err := syscall.Stat(devicePath, &stat); err != nil {
+		return 0, 0, fmt.Errorf("stat device %s error %v", devicePath, err)
+	}
+	if stat.Mode&syscall.S_IFMT != syscall.S_IFBLK {
+		return 0, 0, fmt.Errorf("%s is not a block device", devicePath)
+	}
+	rdev := uint64(stat.Rdev)
+	return int64((rdev>>8)&0xfff | (rdev>>32)&^0xfff), int64(rdev&0xff | (rdev>>12)&^0xff), nil
+}
+
+func splitDeviceSpec(spec string) (string, string, error) {
+	i := strings.LastIndex(spec, ":")
+	if i <= 0 || i == len(spec)-1 || !strings.HasPrefix(spec, "/") {
+		return "", "", fmt.Errorf("invalid device spec %s, should be /dev/path:value", spec)
+	}
+	return spec[:i], spec[i+1:], nil
+}
+
+// 解析 --blkio-weight-device /dev/sda:200
+func ParseWeightDevice(spec string) (*WeightDevice, error) {
+	devicePath, value, err := splitDeviceSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	weight, err := strconv.Atoi(value)
+	if err != nil || weight == 0 {
+		return nil, fmt.Errorf("invalid blkio weight %s in %s", value, spec)
+	}
+	if err := ValidateBlkioWeight(weight); err != nil {
+		return nil, err
+	}
+	major, minor, err := blockDeviceNumber(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	return &WeightDevice{Major: major, Minor: minor, Weight: uint16(weight)}, nil
+}
+
+// 解析 --device-read-bps /dev/sda:1mb 和 --device-read-iops /dev/sda:1000, bps 支持 k/m/g 后缀
+func ParseThrottleDevice(spec string, bps bool) (*ThrottleDevice, error) {
+	devicePath, value, err := splitDeviceSpec(spec)
+	if err != nil {
+		return nil, err
+	}
+	var rate uint64
+	if bps {
+		rate, err = ParseBytes(value)
+	} else {
+		rate, err = strconv.ParseUint(value, 10, 64)
+	}
+	if err != nil || rate == 0 {
+		return nil, fmt.Errorf("invalid rate %s in %s", value, spec)
+	}
+	major, minor, err := blockDeviceNumber(devicePath)
+	if err != nil {
+		return nil, err
+	}
+	return &ThrottleDevice{Major: major, Minor: minor, Rate: rate}, nil
+}
+
+// v1 的 blkio.weight 映射到 v2 的 io.weight [1, 10000]
+func convertBlkioToIOWeight(weight uint16) uint64 {
+	return 1 + (uint64(weight)-MinBlkioWeight)*9999/(MaxBlkioWeight-MinBlkioWeight)
+}
+
+func writeCgroupLine(dir, file, line string) error {
+	if err := ioutil.WriteFile(path.Join(dir, file), []byte(line), 0644); err != nil {
+		return fmt.Errorf("set cgroup %s to %s fail %v", file, line, err)
+	}
+	return nil
+}
+
+// 返回 dir 中第一个存在的文件, 用于兼容 cfq 和 bfq 调度器的不同接口
+func existingFile(dir string, files ...string) string {
+	for _, file := range files {
+		if _, err := os.Stat(path.Join(dir, file)); err == nil {
+			return file
+		}
+	}
+	return ""
+}
+
+type BlkioSubSystem struct {
+}
+
+func (s *BlkioSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if mounted, err := checkMounted(s.Name(), res.BlkioWeight != 0 || len(res.BlkioWeightDevice) > 0 || len(res.BlkioDeviceReadBps) > 0 ||
+		len(res.BlkioDeviceWriteBps) > 0 || len(res.BlkioDeviceReadIOps) > 0 || len(res.BlkioDeviceWriteIOps) > 0); !mounted {
+		return err
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+		if IsCgroup2UnifiedMode() {
+			return s.setUnified(subsysCgroupPath, res)
+		}
+		if res.BlkioWeight != 0 || len(res.BlkioWeightDevice) > 0 {
+			// 权重只在 cfq 或 bfq 调度器下生效, 两者的接口文件名不同
+			weightFile := existingFile(subsysCgroupPath, "blkio.weight", "blkio.bfq.weight")
+			if weightFile == "" {
+				return fmt.Errorf("blkio weight is not supported, cfq or bfq io scheduler is required")
+			}
+			if res.BlkioWeight != 0 {
+				if err := writeCgroupLine(subsysCgroupPath, weightFile, strconv.Itoa(int(res.BlkioWeight))); err != nil {
+					return err
+				}
+			}
+			for _, device := range res.BlkioWeightDevice {
+				if err := writeCgroupLine(subsysCgroupPath, weightFile+"_device", device.String()); err != nil {
+					return err
+				}
+			}
+		}
+		for file, devices := range map[string][]ThrottleDevice{
+			"blkio.throttle.read_bps_device":   res.BlkioDeviceReadBps,
+			"blkio.throttle.write_bps_device":  res.BlkioDeviceWriteBps,
+			"blkio.throttle.read_iops_device":  res.BlkioDeviceReadIOps,
+			"blkio.throttle.write_iops_device": res.BlkioDeviceWriteIOps,
+		} {
+			for _, device := range devices {
+				if err := writeCgroupLine(subsysCgroupPath, file, device.String()); err != nil {
+					return err
+				}
+			}
+		}
+		return nil
+	} else {
+		return err
+	}
+}
+
+// v2 的 io 控制器: 权重写入 io.weight (没有时使用 io.bfq.weight), 限速写入 io.max
+func (s *BlkioSubSystem) setUnified(cgroupPath string, res *ResourceConfig) error {
+	if res.BlkioWeight != 0 || len(res.BlkioWeightDevice) > 0 {
+		weightFile := existingFile(cgroupPath, "io.weight", "io.bfq.weight")
+		if weightFile == "" {
+			return fmt.Errorf("io weight is not supported, io controller is not enabled")
+		}
+		// io.bfq.weight 的范围和 v1 相同, 不需要转换
+		weight := func(w uint16) string {
+			if weightFile == "io.bfq.weight" {
+				return strconv.Itoa(int(w))
+			}
+			return strconv.FormatUint(convertBlkioToIOWeight(w), 10)
+		}
+		if res.BlkioWeight != 0 {
+			if err := writeCgroupLine(cgroupPath, weightFile, "default "+weight(res.BlkioWeight)); err != nil {
+				return err
+			}
+		}
+		for _, device := range res.BlkioWeightDevice {
+			line := fmt.Sprintf("%d:%d %s", device.Major, device.Minor, weight(device.Weight))
+			if err := writeCgroupLine(cgroupPath, weightFile, line); err != nil {
+				return err
+			}
+		}
+	}
+	for key, devices := range map[string][]ThrottleDevice{
+		"rbps":  res.BlkioDeviceReadBps,
+		"wbps":  res.BlkioDeviceWriteBps,
+		"riops": res.BlkioDeviceReadIOps,
+		"wiops": res.BlkioDeviceWriteIOps,
+	} {
+		for _, device := range devices {
+			line := fmt.Sprintf("%d:%d %s=%d", device.Major, device.Minor, key, device.Rate)
+			if err := writeCgroupLine(cgroupPath, "io.max", line); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *BlkioSubSystem) Remove(cgroupPath string) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		return os.RemoveAll(subsysCgroupPath)
+	} else {
+		return err
+	}
+}
+
+func (s *BlkioSubSystem) Apply(cgroupPath string, pid int) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile()), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("set cgroup proc fail %v", err)
+		}
+		return nil
+	} else {
+		return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+	}
+}
+
+// v1 从 blkio.throttle.io_service_bytes/io_serviced 统计, v2 从 io.stat 统计
+func (s *BlkioSubSystem) GetStats(cgroupPath string, stats *Stats) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	devices := map[string]*BlkioDeviceStats{}
+	var order []string
+	device := func(number string) *BlkioDeviceStats {
+		if d, ok := devices[number]; ok {
+			return d
+		}
+		d := &BlkioDeviceStats{}
+		fmt.Sscanf(number, "%d:%d", &d.Major, &d.Minor)
+		devices[number] = d
+		order = append(order, number)
+		return d
+	}
+
+	if IsCgroup2UnifiedMode() {
+		// 没有开启 io 控制器时没有 io.stat
+		err := readCgroupLines(path.Join(subsysCgroupPath, "io.stat"), func(fields []string) {
+			d := device(fields[0])
+			for _, field := range fields[1:] {
+				kv := strings.SplitN(field, "=", 2)
+				if len(kv) != 2 {
+					continue
+				}
+				value, _ := strconv.ParseUint(kv[1], 10, 64)
+				switch kv[0] {
+				case "rbytes":
+					d.ReadBytes = value
+				case "wbytes":
+					d.WriteBytes = value
+				case "rios":
+					d.ReadIOs = value
+				case "wios":
+					d.WriteIOs = value
+				}
+			}
+		})
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	} else {
+		// 每行的格式为 "major:minor Read|Write|Sync|Async|Discard|Total value", 最后一行是 "Total value"
+		for _, file := range []string{"blkio.throttle.io_service_bytes_recursive", "blkio.throttle.io_serviced_recursive"} {
+			serviceBytes := strings.Contains(file, "bytes")
+			err := readCgroupLines(path.Join(subsysCgroupPath, file), func(fields []string) {
+				if len(fields) != 3 {
+					return
+				}
+				value, _ := strconv.ParseUint(fields[2], 10, 64)
+				d := device(fields[0])
+				switch {
+				case fields[1] == "Read" && serviceBytes:
+					d.ReadBytes = value
+				case fields[1] == "Write" && serviceBytes:
+					d.WriteBytes = value
+				case fields[1] == "Read":
+					d.ReadIOs = value
+				case fields[1] == "Write":
+					d.WriteIOs = value
+				}
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	stats.Blkio = &BlkioStats{}
+	for _, number := range order {
+		stats.Blkio.Devices = append(stats.Blkio.Devices, *devices[number])
+	}
+	return nil
+}
+
+func readCgroupLines(file string, handle func(fields []string)) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if fields := strings.Fields(scanner.Text()); len(fields) > 0 {
+			handle(fields)
+		}
+	}
+	return scanner.Err()
+}
+
+func (s *BlkioSubSystem) Name() string {
+	return "blkio"
+}
@@ -0,0 +1,29 @@
+package subsystems
+
+import (
+	"testing"
+)
+
+func TestParseThrottleDevice(t *testing.T) {
+	for _, spec := range []string{"/dev/null:1mb", "/dev/null", "dev/sda:1mb", "/dev/notexist:1mb"} {
+		if _, err := ParseThrottleDevice(spec, true); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+	if _, err := ParseWeightDevice("/dev/null:5"); err == nil {
+		t.Errorf("weight 5 should be invalid")
+	}
+	for _, weight := range []int{0, 10, 1000} {
+		if err := ValidateBlkioWeight(weight); err != nil {
+			t.Errorf("weight %d should be valid: %v", weight, err)
+		}
+	}
+}
+
+func TestConvertBlkioToIOWeight(t *testing.T) {
+	for weight, want := range map[uint16]uint64{10: 1, 500: 4950, 1000: 10000} {
+		if got := convertBlkioToIOWeight(weight); got != want {
+			t.Errorf("blkio weight %d got io weight %d, want %d", weight, got, want)
+		}
+	}
+}
@@ -4,26 +4,182 @@ import (
 	"io/ioutil"
 	"path"
 	"os"
+	"runtime"
 	"strconv"
 )
 
+// cfs 周期的取值范围, 单位微秒
+const (
+	DefaultCpuPeriod = 100000
+	MinCpuPeriod     = 1000
+	MaxCpuPeriod     = 1000000
+	MinCpuQuota      = 1000
+
+	// v1 的 cpu.shares 的取值范围
+	MinCpuShares = 2
+	MaxCpuShares = 262144
+)
+
+// 把 --cpus 换算成默认周期下的 quota, 如 1.5 个 CPU 对应 150000
+func CpusToQuota(cpus float64) (int64, error) {
+	if cpus <= 0 {
+		return 0, fmt.Errorf("invalid cpus %v, should be positive", cpus)
+	}
+	if cpus > float64(runtime.NumCPU()) {
+		return 0, fmt.Errorf("invalid cpus %v, only %d cpus available", cpus, runtime.NumCPU())
+	}
+	return int64(cpus * DefaultCpuPeriod), nil
+}
+
+// 校验 cfs 和实时调度的配置, quota 对应的 CPU 数不能超过宿主机的 CPU 数
+func ValidateCpuConfig(res *ResourceConfig) error {
+	if res.CpuShare != 0 && (res.CpuShare < MinCpuShares || res.CpuShare > MaxCpuShares) {
+		return fmt.Errorf("invalid cpu share %d, should be in range [%d, %d]", res.CpuShare, MinCpuShares, MaxCpuShares)
+	}
+	period := res.CpuPeriod
+	if period == 0 {
+		period = DefaultCpuPeriod
+	}
+	if period < MinCpuPeriod || period > MaxCpuPeriod {
+		return fmt.Errorf("invalid cpu period %d, should be in range [%d, %d]", period, MinCpuPeriod, MaxCpuPeriod)
+	}
+	if res.CpuQuota > 0 {
+		if res.CpuQuota < MinCpuQuota {
+			return fmt.Errorf("invalid cpu quota %d, should be at least %d", res.CpuQuota, MinCpuQuota)
+		}
+		if cpus := float64(res.CpuQuota) / float64(period); cpus > float64(runtime.NumCPU()) {
+			return fmt.Errorf("cpu quota %d with period %d needs %.2f cpus, only %d cpus available", res.CpuQuota, period, cpus, runtime.NumCPU())
+		}
+	} else if res.CpuQuota < -1 {
+		return fmt.Errorf("invalid cpu quota %d, use -1 for unlimited", res.CpuQuota)
+	}
+	if res.CpuRtRuntime < -1 {
+		return fmt.Errorf("invalid cpu rt runtime %d, use -1 for unlimited", res.CpuRtRuntime)
+	}
+	if res.CpuRtPeriod != 0 && res.CpuRtRuntime > int64(res.CpuRtPeriod) {
+		return fmt.Errorf("cpu rt runtime %d should not be greater than rt period %d", res.CpuRtRuntime, res.CpuRtPeriod)
+	}
+	return nil
+}
+
 type CpuSubSystem struct {
 }
 
 func (s *CpuSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if mounted, err := checkMounted(s.Name(), res.CpuShare != 0 || res.CpuPeriod != 0 || res.CpuQuota != 0 || res.CpuRtPeriod != 0 || res.CpuRtRuntime != 0); !mounted {
+		return err
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
-		if res.CpuShare != "" {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpu.shares"), []byte(res.CpuShare), 0644); err != nil {
-				return fmt.Errorf("set cgroup cpu share fail %v", err)
+		if res.CpuShare != 0 {
+			shareFile, share := "cpu.shares", res.CpuShare
+			if IsCgroup2UnifiedMode() {
+				shareFile, share = "cpu.weight", ConvertCPUSharesToWeight(res.CpuShare)
+			}
+			if err := writeCgroupLine(subsysCgroupPath, shareFile, strconv.FormatUint(share, 10)); err != nil {
+				return err
 			}
 		}
-		return nil
+		if err := s.setCfs(subsysCgroupPath, res); err != nil {
+			return err
+		}
+		return s.setRt(subsysCgroupPath, res)
 	} else {
 		return err
 	}
 }
 
+// 把 v1 的 cpu.shares [2, 262144] 线性映射到 v2 的 cpu.weight [1, 10000], 默认值 1024 对应 39
+func ConvertCPUSharesToWeight(shares uint64) uint64 {
+	if shares < MinCpuShares {
+		shares = MinCpuShares
+	} else if shares > MaxCpuShares {
+		shares = MaxCpuShares
+	}
+	return 1 + ((shares-MinCpuShares)*9999)/(MaxCpuShares-MinCpuShares)
+}
+
+// v1 分别写入 cfs_period_us 和 cfs_quota_us, v2 写入 cpu.max 的 "quota period", quota 为 max 表示不限制
+func (s *CpuSubSystem) setCfs(cgroupPath string, res *ResourceConfig) error {
+	if res.CpuPeriod == 0 && res.CpuQuota == 0 {
+		return nil
+	}
+	if IsCgroup2UnifiedMode() {
+		quota, period := "max", res.CpuPeriod
+		if res.CpuQuota > 0 {
+			quota = strconv.FormatInt(res.CpuQuota, 10)
+		}
+		if period == 0 {
+			period = DefaultCpuPeriod
+		}
+		return writeCgroupLine(cgroupPath, "cpu.max", fmt.Sprintf("%s %d", quota, period))
+	}
+	if res.CpuPeriod != 0 {
+		if err := writeCgroupLine(cgroupPath, "cpu.cfs_period_us", strconv.FormatUint(res.CpuPeriod, 10)); err != nil {
+			return err
+		}
+	}
+	if res.CpuQuota != 0 {
+		return writeCgroupLine(cgroupPath, "cpu.cfs_quota_us", strconv.FormatInt(res.CpuQuota, 10))
+	}
+	return nil
+}
+
+// 只有开启了 CONFIG_RT_GROUP_SCHED 的 v1 内核才支持实时调度的限制
+func (s *CpuSubSystem) setRt(cgroupPath string, res *ResourceConfig) error {
+	if res.CpuRtPeriod == 0 && res.CpuRtRuntime == 0 {
+		return nil
+	}
+	if _, err := os.Stat(path.Join(cgroupPath, "cpu.rt_runtime_us")); err != nil {
+		return fmt.Errorf("cpu real-time scheduling is not supported by the kernel")
+	}
+	if res.CpuRtPeriod != 0 {
+		if err := writeCgroupLine(cgroupPath, "cpu.rt_period_us", strconv.FormatUint(res.CpuRtPeriod, 10)); err != nil {
+			return err
+		}
+	}
+	if res.CpuRtRuntime != 0 {
+		return writeCgroupLine(cgroupPath, "cpu.rt_runtime_us", strconv.FormatInt(res.CpuRtRuntime, 10))
+	}
+	return nil
+}
+
+// 从 cpu.stat 读取 cfs 限流的统计, v2 的限流时间单位是微秒
+func (s *CpuSubSystem) GetStats(cgroupPath string, stats *Stats) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	cpu := &CpuStats{}
+	err = readCgroupLines(path.Join(subsysCgroupPath, "cpu.stat"), func(fields []string) {
+		if len(fields) != 2 {
+			return
+		}
+		value, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "nr_periods":
+			cpu.NrPeriods = value
+		case "nr_throttled":
+			cpu.NrThrottled = value
+		case "throttled_time":
+			cpu.ThrottledTime = value
+		case "throttled_usec":
+			cpu.ThrottledTime = value * 1000
+		}
+	})
+	if err != nil {
+		return err
+	}
+	stats.Cpu = cpu
+	return nil
+}
+
 func (s *CpuSubSystem) Remove(cgroupPath string) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
 		return os.RemoveAll(subsysCgroupPath)
 	} else {
@@ -32,8 +188,11 @@ func (s *CpuSubSystem) Remove(cgroupPath string) error {
 }
 
 func (s *CpuSubSystem)Apply(cgroupPath string, pid int) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
-		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "tasks"),  []byte(strconv.Itoa(pid)), 0644); err != nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile()),  []byte(strconv.Itoa(pid)), 0644); err != nil {
 			return fmt.Errorf("set cgroup proc fail %v", err)
 		}
 		return nil
@@ -0,0 +1,44 @@
+package subsystems
+
+import (
+	"runtime"
+	"testing"
+)
+
+func TestConvertCPUSharesToWeight(t *testing.T) {
+	for shares, weight := range map[uint64]uint64{0: 1, 2: 1, 1024: 39, 262144: 10000, 1 << 20: 10000} {
+		if got := ConvertCPUSharesToWeight(shares); got != weight {
+			t.Errorf("shares %d got weight %d, want %d", shares, got, weight)
+		}
+	}
+}
+
+func TestValidateCpuConfig(t *testing.T) {
+	quota, err := CpusToQuota(0.5)
+	if err != nil || quota != 50000 {
+		t.Errorf("cpus 0.5 got quota %d %v", quota, err)
+	}
+	if _, err := CpusToQuota(float64(runtime.NumCPU() + 1)); err == nil {
+		t.Errorf("cpus more than host should fail")
+	}
+	for _, res := range []ResourceConfig{
+		{CpuQuota: 50000},
+		{CpuPeriod: 50000, CpuQuota: -1},
+		{CpuRtPeriod: 1000000, CpuRtRuntime: 950000},
+	} {
+		if err := ValidateCpuConfig(&res); err != nil {
+			t.Errorf("%+v should be valid: %v", res, err)
+		}
+	}
+	for _, res := range []ResourceConfig{
+		{CpuPeriod: 100},
+		{CpuQuota: 100},
+		{CpuQuota: -2},
+		{CpuPeriod: 1000, CpuQuota: int64(runtime.NumCPU()+1) * 1000},
+		{CpuRtPeriod: 1000, CpuRtRuntime: 2000},
+	} {
+		if err := ValidateCpuConfig(&res); err == nil {
+			t.Errorf("%+v should be invalid", res)
+		}
+	}
+}
@@ -5,18 +5,140 @@ import(
 	"io/ioutil"
 	"path"
 	"os"
+	"sort"
 	"strconv"
+	"strings"
 )
 
+// 宿主机上在线的 CPU 和内存节点
+var (
+	OnlineCPUsFile  = "/sys/devices/system/cpu/online"
+	OnlineNodesFile = "/sys/devices/system/node/online"
+)
+
+// 内核的 NR_CPUS 最大为 8192, 在展开范围之前检查, 防止 0-9999999999 这样的范围占用大量内存
+const MaxCPUListID = 8191
+
+// CPU 或内存节点编号的列表, 对应 cpuset.cpus 和 cpuset.mems 中 "0-3,5" 格式的字符串
+type CPUList []int
+
+// 解析 "0-3,5" 格式的列表, 结果按编号排序并去重
+func ParseCPUList(s string) (CPUList, error) {
+	set := map[int]bool{}
+	for _, part := range strings.Split(strings.TrimSpace(s), ",") {
+		bounds := strings.SplitN(part, "-", 2)
+		start, err := strconv.Atoi(bounds[0])
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid cpu list %s", s)
+		}
+		end := start
+		if len(bounds) == 2 {
+			if end, err = strconv.Atoi(bounds[1]); err != nil || end < start {
+				return nil, fmt.Errorf("invalid cpu list %s", s)
+			}
+		}
+		if end > MaxCPUListID {
+			return nil, fmt.Errorf("invalid cpu list %s, cpu or node number should not be greater than %d", s, MaxCPUListID)
+		}
+		for i := start; i <= end; i++ {
+			set[i] = true
+		}
+	}
+	var list CPUList
+	for i := range set {
+		list = append(list, i)
+	}
+	sort.Ints(list)
+	return list, nil
+}
+
+// 连续的编号合并成范围, 和内核输出的格式相同
+func (l CPUList) String() string {
+	var parts []string
+	for i := 0; i < len(l); {
+		j := i
+		for j+1 < len(l) && l[j+1] == l[j]+1 {
+			j++
+		}
+		if i == j {
+			parts = append(parts, strconv.Itoa(l[i]))
+		} else {
+			parts = append(parts, fmt.Sprintf("%d-%d", l[i], l[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(parts, ",")
+}
+
+// l 中的编号都在 available 中时返回 true
+func (l CPUList) subsetOf(available CPUList) bool {
+	set := map[int]bool{}
+	for _, i := range available {
+		set[i] = true
+	}
+	for _, i := range l {
+		if !set[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func readCPUList(file string) (CPUList, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	return ParseCPUList(string(content))
+}
+
+// 指定的 CPU 和内存节点必须在宿主机上在线
+func ValidateCpusetConfig(res *ResourceConfig) error {
+	for _, c := range []struct {
+		name string
+		list CPUList
+		file string
+	}{
+		{"cpus", res.CpuSet, OnlineCPUsFile},
+		{"mems", res.CpusetMems, OnlineNodesFile},
+	} {
+		if len(c.list) == 0 {
+			continue
+		}
+		online, err := readCPUList(c.file)
+		if err != nil {
+			return fmt.Errorf("get online %s error %v", c.name, err)
+		}
+		if !c.list.subsetOf(online) {
+			return fmt.Errorf("requested cpuset %s %s is not available, online %s are %s", c.name, c.list, c.name, online)
+		}
+	}
+	return nil
+}
+
 type CpusetSubSystem struct {
 
 }
 
 func (s *CpusetSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if mounted, err := checkMounted(s.Name(), len(res.CpuSet) > 0 || len(res.CpusetMems) > 0); !mounted {
+		return err
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
-		if res.CpuSet != "" {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "cpuset.cpus"), []byte(res.CpuSet), 0644); err != nil {
-				return fmt.Errorf("set cgroup cpuset fail %v", err)
+		// v1 中新建的 cgroup 的 cpus 和 mems 为空, 不设置时无法加入进程, 也无法创建可用的子 cgroup
+		if !IsCgroup2UnifiedMode() {
+			if err := initCpuset(FindCgroupMountpoint(s.Name()), subsysCgroupPath); err != nil {
+				return err
+			}
+		}
+		if len(res.CpuSet) > 0 {
+			if err := writeCgroupLine(subsysCgroupPath, "cpuset.cpus", res.CpuSet.String()); err != nil {
+				return err
+			}
+		}
+		if len(res.CpusetMems) > 0 {
+			if err := writeCgroupLine(subsysCgroupPath, "cpuset.mems", res.CpusetMems.String()); err != nil {
+				return err
 			}
 		}
 		return nil
@@ -25,7 +147,37 @@ func (s *CpusetSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
 	}
 }
 
+// 从 hierarchy 根目录开始逐级向下, 把为空的 cpus 和 mems 设置成父目录的值
+func initCpuset(root, dir string) error {
+	if path.Clean(dir) == path.Clean(root) {
+		return nil
+	}
+	if err := initCpuset(root, path.Dir(dir)); err != nil {
+		return err
+	}
+	for _, file := range []string{"cpuset.cpus", "cpuset.mems"} {
+		content, err := ioutil.ReadFile(path.Join(dir, file))
+		if err != nil {
+			return err
+		}
+		if strings.TrimSpace(string(content)) != "" {
+			continue
+		}
+		parent, err := ioutil.ReadFile(path.Join(path.Dir(dir), file))
+		if err != nil {
+			return err
+		}
+		if err := writeCgroupLine(dir, file, strings.TrimSpace(string(parent))); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *CpusetSubSystem) Remove(cgroupPath string) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
 		return os.RemoveAll(subsysCgroupPath)
 	} else {
@@ -35,8 +187,11 @@ func (s *CpusetSubSystem) Remove(cgroupPath string) error {
 
 
 func (s *CpusetSubSystem)Apply(cgroupPath string, pid int) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
-		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "tasks"),  []byte(strconv.Itoa(pid)), 0644); err != nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile()),  []byte(strconv.Itoa(pid)), 0644); err != nil {
 			return fmt.Errorf("set cgroup proc fail %v", err)
 		}
 		return nil
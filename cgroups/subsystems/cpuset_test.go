@@ -0,0 +1,53 @@
+package subsystems
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"reflect"
+	"testing"
+)
+
+func TestParseCPUList(t *testing.T) {
+	for s, want := range map[string]CPUList{
+		"0":         {0},
+		"0-3":       {0, 1, 2, 3},
+		"5,0-2\n":   {0, 1, 2, 5},
+		"1,1-2,2":   {1, 2},
+		"0-1,4-5,7": {0, 1, 4, 5, 7},
+	} {
+		list, err := ParseCPUList(s)
+		if err != nil || !reflect.DeepEqual(list, want) {
+			t.Errorf("parse %q got %v %v, want %v", s, list, err, want)
+		}
+	}
+	for _, s := range []string{"", "a", "3-1", "-1", "0,,1", "0-", "0-9999999999", "8192"} {
+		if _, err := ParseCPUList(s); err == nil {
+			t.Errorf("parse %q should fail", s)
+		}
+	}
+	if s := (CPUList{0, 1, 2, 4, 6, 7}).String(); s != "0-2,4,6-7" {
+		t.Errorf("format cpu list got %s", s)
+	}
+}
+
+func TestValidateCpusetConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "cpuset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(cpus, nodes string) { OnlineCPUsFile, OnlineNodesFile = cpus, nodes }(OnlineCPUsFile, OnlineNodesFile)
+	OnlineCPUsFile, OnlineNodesFile = path.Join(dir, "cpus"), path.Join(dir, "nodes")
+	ioutil.WriteFile(OnlineCPUsFile, []byte("0-3\n"), 0644)
+	ioutil.WriteFile(OnlineNodesFile, []byte("0\n"), 0644)
+
+	if err := ValidateCpusetConfig(&ResourceConfig{CpuSet: CPUList{0, 3}, CpusetMems: CPUList{0}}); err != nil {
+		t.Errorf("validate cpuset error %v", err)
+	}
+	for _, res := range []ResourceConfig{{CpuSet: CPUList{4}}, {CpusetMems: CPUList{1}}} {
+		if err := ValidateCpusetConfig(&res); err == nil {
+			t.Errorf("validate %+v should fail", res)
+		}
+	}
+}
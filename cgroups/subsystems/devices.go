@@ -0,0 +1,151 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// devices cgroup 的一条规则, 对应 devices.allow/devices.deny 中的 "type major:minor access"
+type DeviceRule struct {
+	Type   string `json:"type"`   //a 表示所有设备, b 块设备, c 字符设备
+	Major  int64  `json:"major"`  //-1 表示 *
+	Minor  int64  `json:"minor"`  //-1 表示 *
+	Access string `json:"access"` //r 读, w 写, m mknod 的组合
+}
+
+// 参考 docker 的默认规则: 允许 mknod 所有设备, 只允许读写容器 /dev 下默认创建的设备
+var DefaultDeviceRules = []DeviceRule{
+	{Type: "c", Major: -1, Minor: -1, Access: "m"},
+	{Type: "b", Major: -1, Minor: -1, Access: "m"},
+	{Type: "c", Major: 1, Minor: 3, Access: "rwm"},    // /dev/null
+	{Type: "c", Major: 1, Minor: 5, Access: "rwm"},    // /dev/zero
+	{Type: "c", Major: 1, Minor: 7, Access: "rwm"},    // /dev/full
+	{Type: "c", Major: 1, Minor: 8, Access: "rwm"},    // /dev/random
+	{Type: "c", Major: 1, Minor: 9, Access: "rwm"},    // /dev/urandom
+	{Type: "c", Major: 5, Minor: 0, Access: "rwm"},    // /dev/tty
+	{Type: "c", Major: 5, Minor: 1, Access: "rwm"},    // /dev/console
+	{Type: "c", Major: 5, Minor: 2, Access: "rwm"},    // /dev/ptmx
+	{Type: "c", Major: 136, Minor: -1, Access: "rwm"}, // /dev/pts/*
+}
+
+// 允许访问所有设备, 用于 --privileged
+var AllowAllDeviceRule = DeviceRule{Type: "a", Major: -1, Minor: -1, Access: "rwm"}
+
+func deviceNumber(n int64) string {
+	if n == -1 {
+		return "*"
+	}
+	return strconv.FormatInt(n, 10)
+}
+
+func (r DeviceRule) String() string {
+	return fmt.Sprintf("%s %s:%s %s", r.Type, deviceNumber(r.Major), deviceNumber(r.Minor), r.Access)
+}
+
+func parseDeviceNumber(s string) (int64, error) {
+	if s == "*" {
+		return -1, nil
+	}
+	return strconv.ParseInt(s, 10, 64)
+}
+
+// 解析 --device-cgroup-rule 参数, 格式和 devices.allow 相同, 如 "c 10:200 rwm"
+func ParseDeviceRule(rule string) (*DeviceRule, error) {
+	fields := strings.Fields(rule)
+	if len(fields) != 3 {
+		return nil, fmt.Errorf("invalid device cgroup rule %s", rule)
+	}
+	if fields[0] != "a" && fields[0] != "b" && fields[0] != "c" {
+		return nil, fmt.Errorf("invalid device type %s in rule %s", fields[0], rule)
+	}
+	numbers := strings.SplitN(fields[1], ":", 2)
+	if len(numbers) != 2 {
+		return nil, fmt.Errorf("invalid device number %s in rule %s", fields[1], rule)
+	}
+	major, err := parseDeviceNumber(numbers[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid device major %s in rule %s", numbers[0], rule)
+	}
+	minor, err := parseDeviceNumber(numbers[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid device minor %s in rule %s", numbers[1], rule)
+	}
+	if err := ValidateDeviceAccess(fields[2]); err != nil {
+		return nil, err
+	}
+	return &DeviceRule{Type: fields[0], Major: major, Minor: minor, Access: fields[2]}, nil
+}
+
+func ValidateDeviceAccess(access string) error {
+	if access == "" {
+		return fmt.Errorf("empty device access")
+	}
+	for _, c := range access {
+		if !strings.ContainsRune("rwm", c) {
+			return fmt.Errorf("invalid device access %s, should be combination of rwm", access)
+		}
+	}
+	return nil
+}
+
+type DevicesSubSystem struct {
+}
+
+// 先拒绝所有设备, 再逐条写入允许的规则, 没有配置规则时不做限制
+func (s *DevicesSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if mounted, err := checkMounted(s.Name(), len(res.DeviceRules) > 0); !mounted {
+		return err
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+		if len(res.DeviceRules) == 0 {
+			return nil
+		}
+		if IsCgroup2UnifiedMode() {
+			return attachDeviceFilter(subsysCgroupPath, res.DeviceRules)
+		}
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "devices.deny"), []byte("a"), 0644); err != nil {
+			return fmt.Errorf("set cgroup devices deny fail %v", err)
+		}
+		for _, rule := range res.DeviceRules {
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "devices.allow"), []byte(rule.String()), 0644); err != nil {
+				return fmt.Errorf("set cgroup devices allow %s fail %v", rule, err)
+			}
+		}
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (s *DevicesSubSystem) Remove(cgroupPath string) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		return os.RemoveAll(subsysCgroupPath)
+	} else {
+		return err
+	}
+}
+
+func (s *DevicesSubSystem) Apply(cgroupPath string, pid int) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile()), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("set cgroup proc fail %v", err)
+		}
+		return nil
+	} else {
+		return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+	}
+}
+
+func (s *DevicesSubSystem) Name() string {
+	return "devices"
+}
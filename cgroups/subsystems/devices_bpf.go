@@ -0,0 +1,217 @@
+package subsystems
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+	"unsafe"
+)
+
+// cgroup v2 没有 devices.allow/devices.deny, 设备访问控制通过挂载在 cgroup 上的
+// BPF_PROG_TYPE_CGROUP_DEVICE 程序完成, 程序返回 1 允许访问, 返回 0 拒绝
+
+const (
+	bpfProgLoad             = 5
+	bpfProgAttach           = 8
+	bpfProgTypeCgroupDevice = 15
+	bpfCgroupDevice         = 6
+
+	// bpf_cgroup_dev_ctx.access_type 的低 16 位是设备类型, 高 16 位是访问方式
+	bpfDevcgDevBlock = 1
+	bpfDevcgDevChar  = 2
+	bpfDevcgAccMknod = 1
+	bpfDevcgAccRead  = 2
+	bpfDevcgAccWrite = 4
+)
+
+// 老版本的 syscall 包中没有 SYS_BPF
+var sysBPF = map[string]uintptr{
+	"386":     357,
+	"amd64":   321,
+	"arm":     386,
+	"arm64":   280,
+	"ppc64le": 361,
+	"s390x":   351,
+}
+
+// struct bpf_insn, dst 寄存器在 Regs 的低 4 位, src 寄存器在高 4 位
+type bpfInsn struct {
+	Code uint8
+	Regs uint8
+	Off  int16
+	Imm  int32
+}
+
+func bpfLoadWord(dst, src uint8, off int16) bpfInsn {
+	return bpfInsn{Code: 0x61, Regs: src<<4 | dst, Off: off} // BPF_LDX | BPF_MEM | BPF_W
+}
+
+func bpfAndImm(dst uint8, imm int32) bpfInsn {
+	return bpfInsn{Code: 0x57, Regs: dst, Imm: imm} // BPF_ALU64 | BPF_AND | BPF_K
+}
+
+func bpfRshImm(dst uint8, imm int32) bpfInsn {
+	return bpfInsn{Code: 0x77, Regs: dst, Imm: imm} // BPF_ALU64 | BPF_RSH | BPF_K
+}
+
+func bpfMovImm(dst uint8, imm int32) bpfInsn {
+	return bpfInsn{Code: 0xb7, Regs: dst, Imm: imm} // BPF_ALU64 | BPF_MOV | BPF_K
+}
+
+func bpfMovReg(dst, src uint8) bpfInsn {
+	return bpfInsn{Code: 0xbf, Regs: src<<4 | dst} // BPF_ALU64 | BPF_MOV | BPF_X
+}
+
+// 跳转偏移量在规则的指令全部生成之后再填写
+func bpfJneImm(dst uint8, imm int32) bpfInsn {
+	return bpfInsn{Code: 0x55, Regs: dst, Imm: imm} // BPF_JMP | BPF_JNE | BPF_K
+}
+
+func bpfJneReg(dst, src uint8) bpfInsn {
+	return bpfInsn{Code: 0x5d, Regs: src<<4 | dst} // BPF_JMP | BPF_JNE | BPF_X
+}
+
+func bpfExit() bpfInsn {
+	return bpfInsn{Code: 0x95}
+}
+
+func isBpfJump(insn bpfInsn) bool {
+	return insn.Code == 0x55 || insn.Code == 0x5d
+}
+
+// 把允许的设备规则编译成 eBPF 程序, 和 v1 一样默认拒绝, 只放行匹配任意一条规则的访问
+func compileDeviceFilter(rules []DeviceRule) ([]bpfInsn, error) {
+	prog := []bpfInsn{
+		bpfLoadWord(2, 1, 0), // r2 = 设备类型
+		bpfAndImm(2, 0xffff),
+		bpfLoadWord(3, 1, 0), // r3 = 访问方式
+		bpfRshImm(3, 16),
+		bpfLoadWord(4, 1, 4), // r4 = major
+		bpfLoadWord(5, 1, 8), // r5 = minor
+	}
+	for _, rule := range rules {
+		var block []bpfInsn
+		switch rule.Type {
+		case "a":
+		case "b":
+			block = append(block, bpfJneImm(2, bpfDevcgDevBlock))
+		case "c":
+			block = append(block, bpfJneImm(2, bpfDevcgDevChar))
+		default:
+			return nil, fmt.Errorf("invalid device type %s in rule %s", rule.Type, rule)
+		}
+		var access int32
+		for _, c := range rule.Access {
+			switch c {
+			case 'm':
+				access |= bpfDevcgAccMknod
+			case 'r':
+				access |= bpfDevcgAccRead
+			case 'w':
+				access |= bpfDevcgAccWrite
+			default:
+				return nil, fmt.Errorf("invalid device access %s in rule %s", rule.Access, rule)
+			}
+		}
+		// 请求的访问方式必须是规则允许的子集
+		if access != bpfDevcgAccMknod|bpfDevcgAccRead|bpfDevcgAccWrite {
+			block = append(block, bpfMovReg(1, 3), bpfAndImm(1, access), bpfJneReg(1, 3))
+		}
+		if rule.Major != -1 {
+			block = append(block, bpfJneImm(4, int32(rule.Major)))
+		}
+		if rule.Minor != -1 {
+			block = append(block, bpfJneImm(5, int32(rule.Minor)))
+		}
+		block = append(block, bpfMovImm(0, 1), bpfExit())
+		// 条件不满足时跳过这条规则剩下的指令
+		for i := range block {
+			if isBpfJump(block[i]) {
+				block[i].Off = int16(len(block) - i - 1)
+			}
+		}
+		prog = append(prog, block...)
+	}
+	return append(prog, bpfMovImm(0, 0), bpfExit()), nil
+}
+
+type bpfProgLoadAttr struct {
+	ProgType    uint32
+	InsnCnt     uint32
+	Insns       uint64
+	License     uint64
+	LogLevel    uint32
+	LogSize     uint32
+	LogBuf      uint64
+	KernVersion uint32
+	ProgFlags   uint32
+}
+
+type bpfProgAttachAttr struct {
+	TargetFd    uint32
+	AttachBpfFd uint32
+	AttachType  uint32
+	AttachFlags uint32
+}
+
+func bpf(cmd uintptr, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	nr, ok := sysBPF[runtime.GOARCH]
+	if !ok {
+		return 0, fmt.Errorf("bpf is not supported on %s", runtime.GOARCH)
+	}
+	r, _, errno := syscall.Syscall(nr, cmd, uintptr(attr), size)
+	if errno != 0 {
+		return 0, errno
+	}
+	return r, nil
+}
+
+// 加载设备过滤程序并挂载到 cgroup 目录上, 不带 flag 挂载时会替换掉这个 cgroup 上已有的程序
+func attachDeviceFilter(cgroupDir string, rules []DeviceRule) error {
+	prog, err := compileDeviceFilter(rules)
+	if err != nil {
+		return err
+	}
+	license := []byte("GPL\x00")
+	logBuf := make([]byte, 64*1024)
+	loadAttr := bpfProgLoadAttr{
+		ProgType: bpfProgTypeCgroupDevice,
+		InsnCnt:  uint32(len(prog)),
+		Insns:    uint64(uintptr(unsafe.Pointer(&prog[0]))),
+		License:  uint64(uintptr(unsafe.Pointer(&license[0]))),
+		LogLevel: 1,
+		LogSize:  uint32(len(logBuf)),
+		LogBuf:   uint64(uintptr(unsafe.Pointer(&logBuf[0]))),
+	}
+	progFd, err := bpf(bpfProgLoad, unsafe.Pointer(&loadAttr), unsafe.Sizeof(loadAttr))
+	runtime.KeepAlive(prog)
+	runtime.KeepAlive(license)
+	if err != nil {
+		return fmt.Errorf("load device filter error %v: %s", err, cString(logBuf))
+	}
+	defer syscall.Close(int(progFd))
+
+	dirFd, err := syscall.Open(cgroupDir, syscall.O_RDONLY|syscall.O_DIRECTORY, 0)
+	if err != nil {
+		return fmt.Errorf("open cgroup %s error %v", cgroupDir, err)
+	}
+	defer syscall.Close(dirFd)
+	attachAttr := bpfProgAttachAttr{
+		TargetFd:    uint32(dirFd),
+		AttachBpfFd: uint32(progFd),
+		AttachType:  bpfCgroupDevice,
+	}
+	if _, err := bpf(bpfProgAttach, unsafe.Pointer(&attachAttr), unsafe.Sizeof(attachAttr)); err != nil {
+		return fmt.Errorf("attach device filter to %s error %v", cgroupDir, err)
+	}
+	return nil
+}
+
+func cString(b []byte) string {
+	for i, c := range b {
+		if c == 0 {
+			return string(b[:i])
+		}
+	}
+	return string(b)
+}
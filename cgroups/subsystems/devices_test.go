@@ -0,0 +1,87 @@
+package subsystems
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+func TestParseDeviceRule(t *testing.T) {
+	rule, err := ParseDeviceRule("c 10:* rwm")
+	if err != nil {
+		t.Fatalf("parse device rule %v", err)
+	}
+	if *rule != (DeviceRule{Type: "c", Major: 10, Minor: -1, Access: "rwm"}) || rule.String() != "c 10:* rwm" {
+		t.Errorf("parse device rule got %+v", *rule)
+	}
+	for _, spec := range []string{"c 10:200", "x 1:3 rwm", "c 1 rwm", "c a:3 rwm", "c 1:3 rx"} {
+		if _, err := ParseDeviceRule(spec); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+}
+
+func TestDevicesCgroup(t *testing.T) {
+	if FindCgroupMountpoint("devices") == "" || IsCgroup2UnifiedMode() {
+		t.Skip("devices cgroup not mounted")
+	}
+	devSubSys := DevicesSubSystem{}
+	resConfig := ResourceConfig{
+		DeviceRules: append(DefaultDeviceRules, DeviceRule{Type: "c", Major: 10, Minor: 229, Access: "rw"}),
+	}
+	testCgroup := "testdevices"
+
+	if err := devSubSys.Set(testCgroup, &resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	defer devSubSys.Remove(testCgroup)
+
+	list, err := ioutil.ReadFile(path.Join(FindCgroupMountpoint("devices"), testCgroup, "devices.list"))
+	if err != nil {
+		t.Fatalf("read devices.list %v", err)
+	}
+	for _, rule := range []string{"c 1:3 rwm", "c 10:229 rw"} {
+		if !strings.Contains(string(list), rule) {
+			t.Errorf("devices.list missing %s:\n%s", rule, list)
+		}
+	}
+	if strings.Contains(string(list), "a *:* rwm") {
+		t.Errorf("devices.list should not allow all devices:\n%s", list)
+	}
+
+	if err := devSubSys.Apply(testCgroup, os.Getpid()); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	if err := devSubSys.Apply("", os.Getpid()); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+}
+
+func TestCompileDeviceFilter(t *testing.T) {
+	prog, err := compileDeviceFilter([]DeviceRule{
+		{Type: "c", Major: 1, Minor: 3, Access: "rwm"},
+		{Type: "b", Major: -1, Minor: -1, Access: "m"},
+		AllowAllDeviceRule,
+	})
+	if err != nil {
+		t.Fatalf("compile device filter %v", err)
+	}
+	// 6 条加载指令, 每条规则的检查加上 r0 = 1; exit, 最后是 r0 = 0; exit
+	if len(prog) != 6+5+6+2+2 {
+		t.Fatalf("device filter has %d instructions", len(prog))
+	}
+	// c 1:3 rwm 的三个跳转都跳过本规则剩下的指令
+	for i, off := range map[int]int16{6: 4, 7: 3, 8: 2} {
+		if !isBpfJump(prog[i]) || prog[i].Off != off {
+			t.Errorf("instruction %d got %+v, want jump +%d", i, prog[i], off)
+		}
+	}
+	if prog[17] != bpfMovImm(0, 1) || prog[len(prog)-2] != bpfMovImm(0, 0) {
+		t.Errorf("allow all rule should return 1 directly: %+v", prog[17:])
+	}
+	if _, err := compileDeviceFilter([]DeviceRule{{Type: "x", Major: 1, Minor: 3, Access: "rwm"}}); err == nil {
+		t.Errorf("invalid device type should fail")
+	}
+}
@@ -0,0 +1,181 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// 内核支持的大页在这个目录下有 hugepages-<size>kB 子目录
+var HugePagesDir = "/sys/kernel/mm/hugepages"
+
+// 一种大页的用量限制, PageSize 和接口文件名中的格式相同, 如 2MB、1GB
+type HugepageLimit struct {
+	PageSize string `json:"pageSize"`
+	Limit    uint64 `json:"limit"`
+}
+
+// 大页大小转换成 hugetlb 接口文件名中的格式, 单位按 1024 进位
+func hugePageSizeString(size uint64) string {
+	units := []string{"B", "KB", "MB", "GB", "TB"}
+	i := 0
+	for ; size >= 1024 && size%1024 == 0 && i < len(units)-1; i++ {
+		size /= 1024
+	}
+	return strconv.FormatUint(size, 10) + units[i]
+}
+
+// 从 /sys/kernel/mm/hugepages 中获取内核支持的大页大小
+func HugePageSizes() ([]string, error) {
+	files, err := ioutil.ReadDir(HugePagesDir)
+	if err != nil {
+		return nil, fmt.Errorf("read %s error %v", HugePagesDir, err)
+	}
+	var sizes []string
+	for _, file := range files {
+		name := file.Name()
+		if !strings.HasPrefix(name, "hugepages-") || !strings.HasSuffix(name, "kB") {
+			continue
+		}
+		kb, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			continue
+		}
+		sizes = append(sizes, hugePageSizeString(kb<<10))
+	}
+	return sizes, nil
+}
+
+// 解析 --hugetlb-limit 2MB:512MB, 大页大小必须是内核支持的大小
+func ParseHugetlbLimit(spec string) (*HugepageLimit, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid hugetlb limit %s, should be pagesize:limit", spec)
+	}
+	size, err := ParseBytes(parts[0])
+	if err != nil || size == 0 {
+		return nil, fmt.Errorf("invalid hugepage size %s in %s", parts[0], spec)
+	}
+	limit, err := ParseBytes(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid hugetlb limit %s in %s", parts[1], spec)
+	}
+	pageSize := hugePageSizeString(size)
+	sizes, err := HugePageSizes()
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range sizes {
+		if s == pageSize {
+			return &HugepageLimit{PageSize: pageSize, Limit: limit}, nil
+		}
+	}
+	return nil, fmt.Errorf("hugepage size %s is not supported, supported sizes are %s", parts[0], strings.Join(sizes, ", "))
+}
+
+// 很多 v1 系统上没有挂载 hugetlb, 只有设置了限制时才报错
+type HugetlbSubSystem struct {
+}
+
+func (s *HugetlbSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if mounted, err := checkMounted(s.Name(), len(res.HugetlbLimit) > 0); !mounted {
+		return err
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+		// v1 写 hugetlb.<size>.limit_in_bytes, v2 写 hugetlb.<size>.max
+		suffix := "limit_in_bytes"
+		if IsCgroup2UnifiedMode() {
+			suffix = "max"
+		}
+		for _, hugepage := range res.HugetlbLimit {
+			file := fmt.Sprintf("hugetlb.%s.%s", hugepage.PageSize, suffix)
+			if err := writeCgroupLine(subsysCgroupPath, file, strconv.FormatUint(hugepage.Limit, 10)); err != nil {
+				return err
+			}
+		}
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (s *HugetlbSubSystem) Remove(cgroupPath string) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		return os.RemoveAll(subsysCgroupPath)
+	} else {
+		return err
+	}
+}
+
+func (s *HugetlbSubSystem) Apply(cgroupPath string, pid int) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile()), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("set cgroup proc fail %v", err)
+		}
+		return nil
+	} else {
+		return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+	}
+}
+
+// 统计每种大页的用量, v2 没有 max_usage_in_bytes 和 failcnt, 超限次数从 hugetlb.<size>.events 中读取
+func (s *HugetlbSubSystem) GetStats(cgroupPath string, stats *Stats) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	sizes, err := HugePageSizes()
+	if err != nil {
+		return err
+	}
+	for _, size := range sizes {
+		prefix := path.Join(subsysCgroupPath, "hugetlb."+size+".")
+		var hugetlb HugetlbStats
+		if IsCgroup2UnifiedMode() {
+			// 父目录中没有开启 hugetlb 控制器时没有这些文件
+			if hugetlb.Usage, err = readCgroupUint(prefix + "current"); os.IsNotExist(err) {
+				continue
+			} else if err != nil {
+				return err
+			}
+			hugetlb.Limit, _ = readCgroupUint(prefix + "max")
+			readCgroupLines(prefix+"events", func(fields []string) {
+				if len(fields) == 2 && fields[0] == "max" {
+					hugetlb.Failcnt, _ = strconv.ParseUint(fields[1], 10, 64)
+				}
+			})
+		} else {
+			if hugetlb.Usage, err = readCgroupUint(prefix + "usage_in_bytes"); err != nil {
+				return err
+			}
+			hugetlb.MaxUsage, _ = readCgroupUint(prefix + "max_usage_in_bytes")
+			hugetlb.Failcnt, _ = readCgroupUint(prefix + "failcnt")
+			hugetlb.Limit, _ = readCgroupUint(prefix + "limit_in_bytes")
+		}
+		// 不限制时读到的是一个接近 int64 上限的值
+		if hugetlb.Limit >= 1<<62 {
+			hugetlb.Limit = 0
+		}
+		if stats.Hugetlb == nil {
+			stats.Hugetlb = map[string]HugetlbStats{}
+		}
+		stats.Hugetlb[size] = hugetlb
+	}
+	return nil
+}
+
+func (s *HugetlbSubSystem) Name() string {
+	return "hugetlb"
+}
@@ -0,0 +1,41 @@
+package subsystems
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestParseHugetlbLimit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hugepages")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"hugepages-2048kB", "hugepages-1048576kB", "hugepages-64kB"} {
+		if err := os.Mkdir(path.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(old string) { HugePagesDir = old }(HugePagesDir)
+	HugePagesDir = dir
+
+	valid := map[string]HugepageLimit{
+		"2MB:512MB": {PageSize: "2MB", Limit: 512 << 20},
+		"2m:1g":     {PageSize: "2MB", Limit: 1 << 30},
+		"1GB:2GB":   {PageSize: "1GB", Limit: 2 << 30},
+		"64kb:0":    {PageSize: "64KB", Limit: 0},
+	}
+	for spec, expected := range valid {
+		limit, err := ParseHugetlbLimit(spec)
+		if err != nil || *limit != expected {
+			t.Errorf("parse %s got %+v %v, expected %+v", spec, limit, err, expected)
+		}
+	}
+	for _, spec := range []string{"4MB:1GB", "2MB", "2MB:abc", "0:1GB", "2MB:1GB:1"} {
+		if _, err := ParseHugetlbLimit(spec); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+}
@@ -8,14 +8,92 @@ import(
 	"strconv"
 )
 
+// 校验内存相关的配置, swap 是内存加 swap 的总量, 和 docker 的 --memory-swap 含义相同
+func ValidateMemoryConfig(res *ResourceConfig) error {
+	limit := res.MemoryLimit
+	if limit < 0 {
+		return fmt.Errorf("invalid memory limit %d", limit)
+	}
+	if limit > 0 {
+		// 读取不到宿主机的内存总量时不检查
+		if total, err := hostMemTotal(); err == nil && uint64(limit) > total {
+			return fmt.Errorf("memory limit %d is greater than total memory %d of the host", limit, total)
+		}
+	}
+	if res.MemorySwap > 0 {
+		if limit == 0 {
+			return fmt.Errorf("memory swap can not be set without memory limit")
+		}
+		if res.MemorySwap < limit {
+			return fmt.Errorf("memory swap %d should not be smaller than memory limit %d", res.MemorySwap, limit)
+		}
+	} else if res.MemorySwap < -1 {
+		return fmt.Errorf("invalid memory swap %d, use -1 for unlimited", res.MemorySwap)
+	}
+	if res.MemoryReservation < 0 || (limit != 0 && res.MemoryReservation > limit) {
+		return fmt.Errorf("invalid memory reservation %d, should not be greater than memory limit", res.MemoryReservation)
+	}
+	if res.MemorySwappiness != nil && (*res.MemorySwappiness < 0 || *res.MemorySwappiness > 100) {
+		return fmt.Errorf("invalid memory swappiness %d, should be in range [0, 100]", *res.MemorySwappiness)
+	}
+	if res.KernelMemory < 0 {
+		return fmt.Errorf("invalid kernel memory %d", res.KernelMemory)
+	}
+	return nil
+}
+
+// 从 /proc/meminfo 中读取宿主机的内存总量
+func hostMemTotal() (uint64, error) {
+	var total uint64
+	found := false
+	err := readCgroupLines("/proc/meminfo", func(fields []string) {
+		if len(fields) == 3 && fields[0] == "MemTotal:" && fields[2] == "kB" {
+			kb, err := strconv.ParseUint(fields[1], 10, 64)
+			total, found = kb<<10, err == nil
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return 0, fmt.Errorf("MemTotal not found in /proc/meminfo")
+	}
+	return total, nil
+}
+
 type MemorySubSystem struct {
 }
 
 func (s *MemorySubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if mounted, err := checkMounted(s.Name(), res.MemoryLimit != 0 || res.MemorySwap != 0 || res.MemoryReservation != 0 ||
+		res.MemorySwappiness != nil || res.KernelMemory != 0 || res.OomKillDisable); !mounted {
+		return err
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
-		if res.MemoryLimit != "" {
-			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "memory.limit_in_bytes"), []byte(res.MemoryLimit), 0644); err != nil {
-				return fmt.Errorf("set cgroup memory fail %v", err)
+		if IsCgroup2UnifiedMode() {
+			return s.setUnified(subsysCgroupPath, res)
+		}
+		if err := s.setLimitAndSwap(subsysCgroupPath, res); err != nil {
+			return err
+		}
+		if res.MemoryReservation != 0 {
+			if err := writeCgroupLine(subsysCgroupPath, "memory.soft_limit_in_bytes", strconv.FormatInt(res.MemoryReservation, 10)); err != nil {
+				return err
+			}
+		}
+		if res.MemorySwappiness != nil {
+			if err := writeCgroupLine(subsysCgroupPath, "memory.swappiness", strconv.FormatInt(*res.MemorySwappiness, 10)); err != nil {
+				return err
+			}
+		}
+		if res.KernelMemory != 0 {
+			if err := writeCgroupLine(subsysCgroupPath, "memory.kmem.limit_in_bytes", strconv.FormatInt(res.KernelMemory, 10)); err != nil {
+				return err
+			}
+		}
+		if res.OomKillDisable {
+			if err := writeCgroupLine(subsysCgroupPath, "memory.oom_control", "1"); err != nil {
+				return err
 			}
 		}
 		return nil
@@ -25,7 +103,87 @@ func (s *MemorySubSystem) Set(cgroupPath string, res *ResourceConfig) error {
 
 }
 
+// memsw.limit_in_bytes 不能小于 limit_in_bytes, 所以调大 swap 时先写 memsw, 否则先写 limit
+func (s *MemorySubSystem) setLimitAndSwap(cgroupPath string, res *ResourceConfig) error {
+	files := []string{}
+	values := map[string]string{}
+	if res.MemoryLimit != 0 {
+		files = append(files, "memory.limit_in_bytes")
+		values["memory.limit_in_bytes"] = strconv.FormatInt(res.MemoryLimit, 10)
+	}
+	if res.MemorySwap != 0 {
+		swapFile := path.Join(cgroupPath, "memory.memsw.limit_in_bytes")
+		current, err := readCgroupUint(swapFile)
+		if err != nil {
+			return fmt.Errorf("memory swap limit is not supported, swap accounting is disabled")
+		}
+		values["memory.memsw.limit_in_bytes"] = strconv.FormatInt(res.MemorySwap, 10)
+		if res.MemorySwap == -1 || uint64(res.MemorySwap) > current {
+			files = append([]string{"memory.memsw.limit_in_bytes"}, files...)
+		} else {
+			files = append(files, "memory.memsw.limit_in_bytes")
+		}
+	}
+	for _, file := range files {
+		if err := writeCgroupLine(cgroupPath, file, values[file]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// v2 的 memory.swap.max 只限制 swap 不包含内存, memory.low 对应 v1 的软限制
+func (s *MemorySubSystem) setUnified(cgroupPath string, res *ResourceConfig) error {
+	if res.MemoryLimit != 0 {
+		if err := writeCgroupLine(cgroupPath, "memory.max", strconv.FormatInt(res.MemoryLimit, 10)); err != nil {
+			return err
+		}
+	}
+	if res.MemorySwap != 0 {
+		swap := "max"
+		if res.MemorySwap > 0 {
+			swap = strconv.FormatInt(res.MemorySwap-res.MemoryLimit, 10)
+		}
+		if existingFile(cgroupPath, "memory.swap.max") == "" {
+			return fmt.Errorf("memory swap limit is not supported, swap accounting is disabled")
+		}
+		if err := writeCgroupLine(cgroupPath, "memory.swap.max", swap); err != nil {
+			return err
+		}
+	}
+	if res.MemoryReservation != 0 {
+		if err := writeCgroupLine(cgroupPath, "memory.low", strconv.FormatInt(res.MemoryReservation, 10)); err != nil {
+			return err
+		}
+	}
+	if res.MemorySwappiness != nil {
+		return fmt.Errorf("memory swappiness is not supported on cgroup v2")
+	}
+	if res.KernelMemory != 0 {
+		return fmt.Errorf("kernel memory limit is not supported on cgroup v2")
+	}
+	if res.OomKillDisable {
+		return fmt.Errorf("disabling oom killer is not supported on cgroup v2")
+	}
+	return nil
+}
+
+// cgroup 当前使用的内存, v1 从 memory.usage_in_bytes 读取, v2 从 memory.current 读取
+func MemoryUsage(cgroupPath string) (uint64, error) {
+	subsysCgroupPath, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	if IsCgroup2UnifiedMode() {
+		return readCgroupUint(path.Join(subsysCgroupPath, "memory.current"))
+	}
+	return readCgroupUint(path.Join(subsysCgroupPath, "memory.usage_in_bytes"))
+}
+
 func (s *MemorySubSystem) Remove(cgroupPath string) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
 		return os.RemoveAll(subsysCgroupPath)
 	} else {
@@ -35,8 +193,11 @@ func (s *MemorySubSystem) Remove(cgroupPath string) error {
 
 
 func (s *MemorySubSystem) Apply(cgroupPath string, pid int) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
 	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
-		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "tasks"),  []byte(strconv.Itoa(pid)), 0644); err != nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile()),  []byte(strconv.Itoa(pid)), 0644); err != nil {
 			return fmt.Errorf("set cgroup proc fail %v", err)
 		}
 		return nil
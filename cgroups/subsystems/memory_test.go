@@ -1,6 +1,7 @@
 package subsystems
 
 import(
+	"io/ioutil"
 	"testing"
 	"os"
 	"path"
@@ -9,7 +10,7 @@ import(
 func TestMemoryCgroup(t *testing.T) {
 	memSubSys := MemorySubSystem{}
 	resConfig := ResourceConfig{
-		MemoryLimit: "1000m",
+		MemoryLimit: 1000 << 20,
 	}
 	testCgroup := "testmemlimit"
 
@@ -31,3 +32,54 @@ func TestMemoryCgroup(t *testing.T) {
 		t.Fatalf("cgroup remove %v", err)
 	}
 }
+
+func TestValidateMemoryConfig(t *testing.T) {
+	swappiness, badSwappiness := int64(60), int64(101)
+	valid := []ResourceConfig{
+		{MemoryLimit: 100 << 20, MemorySwap: 200 << 20, MemoryReservation: 50 << 20, MemorySwappiness: &swappiness},
+		{MemoryLimit: 100 << 20, MemorySwap: -1},
+		{MemorySwap: -1},
+		{MemoryReservation: 50 << 20, KernelMemory: 10 << 20},
+	}
+	for _, res := range valid {
+		if err := ValidateMemoryConfig(&res); err != nil {
+			t.Errorf("validate %+v error %v", res, err)
+		}
+	}
+	invalid := []ResourceConfig{
+		{MemorySwap: 200 << 20},
+		{MemoryLimit: 100 << 20, MemorySwap: 50 << 20},
+		{MemoryLimit: 100 << 20, MemorySwap: -2},
+		{MemoryLimit: 100 << 20, MemoryReservation: 200 << 20},
+		{MemorySwappiness: &badSwappiness},
+		{MemoryLimit: -1},
+		{MemoryLimit: 1 << 60},
+	}
+	for _, res := range invalid {
+		if err := ValidateMemoryConfig(&res); err == nil {
+			t.Errorf("validate %+v should fail", res)
+		}
+	}
+}
+
+func TestReadOOMKillCount(t *testing.T) {
+	dir, err := ioutil.TempDir("", "oom")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	files := map[string]uint64{
+		"oom_kill_disable 0\nunder_oom 0\noom_kill 3\n":                3,
+		"oom_kill_disable 1\nunder_oom 1\n":                            1,
+		"low 0\nhigh 0\nmax 12\noom 2\noom_kill 2\noom_group_kill 0\n": 2,
+	}
+	for content, expected := range files {
+		file := path.Join(dir, "events")
+		if err := ioutil.WriteFile(file, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if count, err := readOOMKillCount(file); err != nil || count != expected {
+			t.Errorf("read %q got %d %v, expected %d", content, count, err, expected)
+		}
+	}
+}
@@ -0,0 +1,143 @@
+package subsystems
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strconv"
+	"syscall"
+	"unsafe"
+)
+
+// v1 通过 cgroup.event_control 把 eventfd 注册到 memory.oom_control 上, 发生 OOM 时 eventfd 可读
+// v2 没有 event_control, 通过 inotify 监听 memory.events 的修改, 再比较其中的 oom_kill 计数
+
+// 返回的 channel 在每次发生 OOM 时收到一个值, cgroup 被删除后关闭
+func NotifyOOM(cgroupPath string) (<-chan struct{}, error) {
+	dir, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return nil, err
+	}
+	if IsCgroup2UnifiedMode() {
+		return notifyOOMUnified(dir)
+	}
+	return notifyOOM(dir)
+}
+
+func notifyOOM(dir string) (<-chan struct{}, error) {
+	oomControl, err := os.Open(path.Join(dir, "memory.oom_control"))
+	if err != nil {
+		return nil, err
+	}
+	r, _, errno := syscall.RawSyscall(syscall.SYS_EVENTFD2, 0, syscall.O_CLOEXEC, 0)
+	if errno != 0 {
+		oomControl.Close()
+		return nil, fmt.Errorf("create eventfd error %v", errno)
+	}
+	eventFd := os.NewFile(r, "eventfd")
+	line := fmt.Sprintf("%d %d", eventFd.Fd(), oomControl.Fd())
+	if err := writeCgroupLine(dir, "cgroup.event_control", line); err != nil {
+		eventFd.Close()
+		oomControl.Close()
+		return nil, err
+	}
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			eventFd.Close()
+			oomControl.Close()
+		}()
+		buf := make([]byte, 8)
+		for {
+			if _, err := eventFd.Read(buf); err != nil {
+				return
+			}
+			// cgroup 被删除时内核也会通知一次, 这时 oom_control 已经不存在
+			if _, err := os.Lstat(path.Join(dir, "memory.oom_control")); os.IsNotExist(err) {
+				return
+			}
+			ch <- struct{}{}
+		}
+	}()
+	return ch, nil
+}
+
+func notifyOOMUnified(dir string) (<-chan struct{}, error) {
+	eventsFile := path.Join(dir, "memory.events")
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC)
+	if err != nil {
+		return nil, fmt.Errorf("inotify init error %v", err)
+	}
+	if _, err := syscall.InotifyAddWatch(fd, eventsFile, syscall.IN_MODIFY|syscall.IN_DELETE_SELF|syscall.IN_IGNORED); err != nil {
+		syscall.Close(fd)
+		return nil, fmt.Errorf("watch %s error %v", eventsFile, err)
+	}
+	last, _ := readOOMKillCount(eventsFile)
+	inotify := os.NewFile(uintptr(fd), "inotify")
+	ch := make(chan struct{})
+	go func() {
+		defer func() {
+			close(ch)
+			inotify.Close()
+		}()
+		buf := make([]byte, syscall.SizeofInotifyEvent+syscall.PathMax+1)
+		for {
+			n, err := inotify.Read(buf)
+			if err != nil || n < syscall.SizeofInotifyEvent {
+				return
+			}
+			event := (*syscall.InotifyEvent)(unsafe.Pointer(&buf[0]))
+			if event.Mask&(syscall.IN_DELETE_SELF|syscall.IN_IGNORED) != 0 {
+				return
+			}
+			count, err := readOOMKillCount(eventsFile)
+			if err != nil {
+				return
+			}
+			if count > last {
+				last = count
+				ch <- struct{}{}
+			}
+		}
+	}()
+	return ch, nil
+}
+
+// cgroup 中被 OOM killer 杀掉的进程数, v1 从 memory.oom_control 读取, v2 从 memory.events 读取
+func OOMKillCount(cgroupPath string) (uint64, error) {
+	dir, err := GetCgroupPath("memory", cgroupPath, false)
+	if err != nil {
+		return 0, err
+	}
+	if IsCgroup2UnifiedMode() {
+		return readOOMKillCount(path.Join(dir, "memory.events"))
+	}
+	return readOOMKillCount(path.Join(dir, "memory.oom_control"))
+}
+
+// 两个文件都是 "key value" 格式, 老内核的 oom_control 中没有 oom_kill, 这时根据 under_oom 判断
+func readOOMKillCount(file string) (uint64, error) {
+	var count, underOOM uint64
+	found := false
+	err := readCgroupLines(file, func(fields []string) {
+		if len(fields) != 2 {
+			return
+		}
+		value, _ := strconv.ParseUint(fields[1], 10, 64)
+		switch fields[0] {
+		case "oom_kill":
+			count = value
+			found = true
+		case "under_oom":
+			underOOM = value
+		}
+	})
+	if err != nil {
+		return 0, err
+	}
+	if !found {
+		return underOOM, nil
+	}
+	return count, nil
+}
@@ -0,0 +1,84 @@
+package subsystems
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+)
+
+// v1 和 v2 的 pids 接口文件名相同
+type PidsSubSystem struct {
+}
+
+func (s *PidsSubSystem) Set(cgroupPath string, res *ResourceConfig) error {
+	if mounted, err := checkMounted(s.Name(), res.PidsLimit != 0); !mounted {
+		return err
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, true); err == nil {
+		if res.PidsLimit != 0 {
+			limit := "max"
+			if res.PidsLimit > 0 {
+				limit = strconv.FormatInt(res.PidsLimit, 10)
+			}
+			if err := ioutil.WriteFile(path.Join(subsysCgroupPath, "pids.max"), []byte(limit), 0644); err != nil {
+				return fmt.Errorf("set cgroup pids limit fail %v", err)
+			}
+		}
+		return nil
+	} else {
+		return err
+	}
+}
+
+func (s *PidsSubSystem) Remove(cgroupPath string) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		return os.RemoveAll(subsysCgroupPath)
+	} else {
+		return err
+	}
+}
+
+func (s *PidsSubSystem) Apply(cgroupPath string, pid int) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	if subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false); err == nil {
+		if err := ioutil.WriteFile(path.Join(subsysCgroupPath, procsFile()), []byte(strconv.Itoa(pid)), 0644); err != nil {
+			return fmt.Errorf("set cgroup proc fail %v", err)
+		}
+		return nil
+	} else {
+		return fmt.Errorf("get cgroup %s error: %v", cgroupPath, err)
+	}
+}
+
+// pids.peak 在较新的内核中才有, 不存在时峰值为 0
+func (s *PidsSubSystem) GetStats(cgroupPath string, stats *Stats) error {
+	if !subsystemMounted(s.Name()) {
+		return nil
+	}
+	subsysCgroupPath, err := GetCgroupPath(s.Name(), cgroupPath, false)
+	if err != nil {
+		return err
+	}
+	current, err := readCgroupUint(path.Join(subsysCgroupPath, "pids.current"))
+	if err != nil {
+		return err
+	}
+	limit, err := readCgroupUint(path.Join(subsysCgroupPath, "pids.max"))
+	if err != nil {
+		return err
+	}
+	peak, _ := readCgroupUint(path.Join(subsysCgroupPath, "pids.peak"))
+	stats.Pids = &PidsStats{Current: current, Peak: peak, Limit: limit}
+	return nil
+}
+
+func (s *PidsSubSystem) Name() string {
+	return "pids"
+}
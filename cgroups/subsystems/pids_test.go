@@ -0,0 +1,37 @@
+package subsystems
+
+import (
+	"os"
+	"testing"
+)
+
+func TestPidsCgroup(t *testing.T) {
+	if FindCgroupMountpoint("pids") == "" {
+		t.Skip("pids cgroup not mounted")
+	}
+	pidsSubSys := PidsSubSystem{}
+	resConfig := ResourceConfig{
+		PidsLimit: 100,
+	}
+	testCgroup := "testpidslimit"
+
+	if err := pidsSubSys.Set(testCgroup, &resConfig); err != nil {
+		t.Fatalf("cgroup fail %v", err)
+	}
+	defer pidsSubSys.Remove(testCgroup)
+	if err := pidsSubSys.Apply(testCgroup, os.Getpid()); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	stats := &Stats{}
+	err := pidsSubSys.GetStats(testCgroup, stats)
+	//将进程移回到根Cgroup节点
+	if err := pidsSubSys.Apply("", os.Getpid()); err != nil {
+		t.Fatalf("cgroup Apply %v", err)
+	}
+	if err != nil {
+		t.Fatalf("cgroup stats %v", err)
+	}
+	if stats.Pids == nil || stats.Pids.Current == 0 || stats.Pids.Limit != 100 {
+		t.Errorf("pids stats %+v", stats.Pids)
+	}
+}
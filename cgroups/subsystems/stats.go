@@ -0,0 +1,68 @@
+package subsystems
+
+import (
+	"io/ioutil"
+	"strconv"
+	"strings"
+)
+
+// cgroup 的资源使用情况, 只包含能统计的 subsystem
+type Stats struct {
+	Pids    *PidsStats              `json:"pids,omitempty"`
+	Blkio   *BlkioStats             `json:"blkio,omitempty"`
+	Cpu     *CpuStats               `json:"cpu,omitempty"`
+	Hugetlb map[string]HugetlbStats `json:"hugetlb,omitempty"` //key 是大页大小, 如 2MB
+}
+
+type PidsStats struct {
+	Current uint64 `json:"current"`
+	Peak    uint64 `json:"peak"`
+	Limit   uint64 `json:"limit,omitempty"` //0 表示不限制
+}
+
+// cfs 周期数和被限流的周期数, 限流时间单位为纳秒
+type CpuStats struct {
+	NrPeriods     uint64 `json:"nrPeriods"`
+	NrThrottled   uint64 `json:"nrThrottled"`
+	ThrottledTime uint64 `json:"throttledTime"`
+}
+
+type BlkioStats struct {
+	Devices []BlkioDeviceStats `json:"devices"`
+}
+
+// 块设备累计的读写字节数和次数
+type BlkioDeviceStats struct {
+	Major      int64  `json:"major"`
+	Minor      int64  `json:"minor"`
+	ReadBytes  uint64 `json:"readBytes"`
+	WriteBytes uint64 `json:"writeBytes"`
+	ReadIOs    uint64 `json:"readIOs"`
+	WriteIOs   uint64 `json:"writeIOs"`
+}
+
+// 大页的用量, 单位为字节, Failcnt 是超过限制的次数
+type HugetlbStats struct {
+	Usage    uint64 `json:"usage"`
+	MaxUsage uint64 `json:"maxUsage,omitempty"`
+	Failcnt  uint64 `json:"failcnt"`
+	Limit    uint64 `json:"limit,omitempty"` //0 表示不限制
+}
+
+// 支持统计资源使用情况的 subsystem
+type StatsSubsystem interface {
+	GetStats(cgroupPath string, stats *Stats) error
+}
+
+// 读取只包含一个数字的 cgroup 文件, max 表示不限制, 返回 0
+func readCgroupUint(file string) (uint64, error) {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return 0, err
+	}
+	value := strings.TrimSpace(string(content))
+	if value == "max" {
+		return 0, nil
+	}
+	return strconv.ParseUint(value, 10, 64)
+}
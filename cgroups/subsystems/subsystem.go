@@ -1,11 +1,53 @@
 package subsystems
 
+import "fmt"
+
 type ResourceConfig struct {
-	MemoryLimit string
-	CpuShare    string
-	CpuSet      string
+	MemoryLimit          int64            `json:"memoryLimit,omitempty"`       //内存限制的字节数
+	MemorySwap           int64            `json:"memorySwap,omitempty"`        //内存加 swap 的总量, -1 表示不限制 swap
+	MemoryReservation    int64            `json:"memoryReservation,omitempty"` //内存的软限制
+	MemorySwappiness     *int64           `json:"memorySwappiness,omitempty"`
+	KernelMemory         int64            `json:"kernelMemory,omitempty"`
+	OomKillDisable       bool             `json:"oomKillDisable,omitempty"`
+	CpuShare             uint64           `json:"cpuShare,omitempty"`
+	CpuSet               CPUList          `json:"cpuSet,omitempty"`       //可以使用的 CPU
+	CpusetMems           CPUList          `json:"cpusetMems,omitempty"`   //可以使用的内存节点
+	CpuPeriod            uint64           `json:"cpuPeriod,omitempty"`    //cfs 周期, 单位微秒
+	CpuQuota             int64            `json:"cpuQuota,omitempty"`     //每个周期内可以使用的 CPU 时间, -1 表示不限制
+	CpuRtPeriod          uint64           `json:"cpuRtPeriod,omitempty"`  //实时调度的周期
+	CpuRtRuntime         int64            `json:"cpuRtRuntime,omitempty"` //每个周期内实时任务可以使用的 CPU 时间
+	PidsLimit            int64            `json:"pidsLimit,omitempty"`    //-1 表示不限制
+	BlkioWeight          uint16           `json:"blkioWeight,omitempty"`
+	BlkioWeightDevice    []WeightDevice   `json:"blkioWeightDevice,omitempty"`
+	BlkioDeviceReadBps   []ThrottleDevice `json:"blkioDeviceReadBps,omitempty"`
+	BlkioDeviceWriteBps  []ThrottleDevice `json:"blkioDeviceWriteBps,omitempty"`
+	BlkioDeviceReadIOps  []ThrottleDevice `json:"blkioDeviceReadIOps,omitempty"`
+	BlkioDeviceWriteIOps []ThrottleDevice `json:"blkioDeviceWriteIOps,omitempty"`
+	HugetlbLimit         []HugepageLimit  `json:"hugetlbLimit,omitempty"`
+	DeviceRules          []DeviceRule     `json:"deviceRules,omitempty"`
+}
+
+// 写入 cgroup 之前检查所有的限制, CPU、内存节点和内存总量不能超出宿主机的范围
+func (r *ResourceConfig) Validate() error {
+	if err := ValidateCpuConfig(r); err != nil {
+		return err
+	}
+	if err := ValidateCpusetConfig(r); err != nil {
+		return err
+	}
+	if err := ValidateMemoryConfig(r); err != nil {
+		return err
+	}
+	if err := ValidateBlkioWeight(int(r.BlkioWeight)); err != nil {
+		return err
+	}
+	if r.PidsLimit < -1 {
+		return fmt.Errorf("invalid pids limit %d, use -1 for unlimited", r.PidsLimit)
+	}
+	return nil
 }
 
+// cgroup v2 模式下 Set 写入 v2 的接口文件, 所有 subsystem 共用一个目录, CgroupManager 只在这个目录上 Apply 和 Remove 一次
 type Subsystem interface {
 	Name() string
 	Set(path string, res *ResourceConfig) error
@@ -18,5 +60,9 @@ var (
 		&CpusetSubSystem{},
 		&MemorySubSystem{},
 		&CpuSubSystem{},
+		&DevicesSubSystem{},
+		&PidsSubSystem{},
+		&BlkioSubSystem{},
+		&HugetlbSubSystem{},
 	}
 )
@@ -6,10 +6,47 @@ import (
 	"os"
 	"path"
 	"bufio"
+	"math"
+	"strconv"
+	"sync"
+	"syscall"
 )
 
+// cgroup v2 (unified) 模式下所有控制器都挂载在这个目录
+const UnifiedMountpoint = "/sys/fs/cgroup"
+
+// statfs 返回的 cgroup2 文件系统类型
+const cgroup2SuperMagic = 0x63677270
+
+var (
+	unifiedOnce sync.Once
+	unifiedMode bool
+)
+
+// /sys/fs/cgroup 本身挂载的是 cgroup2 时使用 v2, 混合模式 (v1 控制器加 /sys/fs/cgroup/unified) 仍然使用 v1
+func IsCgroup2UnifiedMode() bool {
+	unifiedOnce.Do(func() {
+		var st syscall.Statfs_t
+		if err := syscall.Statfs(UnifiedMountpoint, &st); err == nil {
+			unifiedMode = st.Type == cgroup2SuperMagic
+		}
+	})
+	return unifiedMode
+}
+
+// v1 把进程加入 cgroup 写 tasks, v2 写 cgroup.procs
+func procsFile() string {
+	if IsCgroup2UnifiedMode() {
+		return "cgroup.procs"
+	}
+	return "tasks"
+}
 
 func FindCgroupMountpoint(subsystem string) string {
+	// v2 的挂载选项中没有控制器名, 所有控制器共用一个 hierarchy
+	if IsCgroup2UnifiedMode() {
+		return UnifiedMountpoint
+	}
 	f, err := os.Open("/proc/self/mountinfo")
 	if err != nil {
 		return ""
@@ -33,11 +70,30 @@ func FindCgroupMountpoint(subsystem string) string {
 	return ""
 }
 
+// v1 中没有挂载的控制器只有在需要设置限制时才报错, 否则跳过这个 subsystem
+func checkMounted(subsystem string, requested bool) (bool, error) {
+	if FindCgroupMountpoint(subsystem) != "" {
+		return true, nil
+	}
+	if requested {
+		return false, fmt.Errorf("%s cgroup is not mounted", subsystem)
+	}
+	return false, nil
+}
+
+func subsystemMounted(subsystem string) bool {
+	return FindCgroupMountpoint(subsystem) != ""
+}
+
 func GetCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string, error) {
 	cgroupRoot := FindCgroupMountpoint(subsystem)
+	// 挂载点为空时路径会变成相对于当前目录的路径
+	if cgroupRoot == "" {
+		return "", fmt.Errorf("%s cgroup is not mounted", subsystem)
+	}
 	if _, err := os.Stat(path.Join(cgroupRoot, cgroupPath)); err == nil || (autoCreate && os.IsNotExist(err)) {
 		if os.IsNotExist(err) {
-			if err := os.Mkdir(path.Join(cgroupRoot, cgroupPath), 0755); err == nil {
+			if err := os.MkdirAll(path.Join(cgroupRoot, cgroupPath), 0755); err == nil {
 			} else {
 				return "", fmt.Errorf("error create cgroup %v", err)
 			}
@@ -46,4 +102,30 @@ func GetCgroupPath(subsystem string, cgroupPath string, autoCreate bool) (string
 	} else {
 		return "", fmt.Errorf("cgroup path error %v", err)
 	}
-}
\ No newline at end of file
+}
+// 解析带单位的字节数, 如 1024, 10k, 1mb, 2G, 单位按 1024 进位
+func ParseBytes(s string) (uint64, error) {
+	value := strings.ToLower(strings.TrimSpace(s))
+	value = strings.TrimSuffix(value, "b")
+	multiplier := uint64(1)
+	if n := len(value); n > 0 {
+		switch value[n-1] {
+		case 'k':
+			multiplier = 1 << 10
+		case 'm':
+			multiplier = 1 << 20
+		case 'g':
+			multiplier = 1 << 30
+		case 't':
+			multiplier = 1 << 40
+		}
+		if multiplier != 1 {
+			value = value[:n-1]
+		}
+	}
+	number, err := strconv.ParseUint(value, 10, 64)
+	if err != nil || number > math.MaxUint64/multiplier {
+		return 0, fmt.Errorf("invalid size %s", s)
+	}
+	return number * multiplier, nil
+}
@@ -1,6 +1,8 @@
 package subsystems
 
 import(
+	"io/ioutil"
+	"os"
 	"testing"
 )
 
@@ -8,4 +10,43 @@ func TestFindCgroupMountpoint(t *testing.T) {
 	t.Logf("cpu subsystem mount point %v\n", FindCgroupMountpoint("cpu"))
 	t.Logf("cpuset subsystem mount point %v\n", FindCgroupMountpoint("cpuset"))
 	t.Logf("memory subsystem mount point %v\n", FindCgroupMountpoint("memory"))
-}
\ No newline at end of file
+}
+func TestParseBytes(t *testing.T) {
+	for s, want := range map[string]uint64{"1024": 1024, "10k": 10 << 10, "1mb": 1 << 20, "2G": 2 << 30, "512B": 512} {
+		if got, err := ParseBytes(s); err != nil || got != want {
+			t.Errorf("parse %s got %d %v, want %d", s, got, err, want)
+		}
+	}
+	for _, s := range []string{"", "m", "1x", "-1k", "99999999999999999999"} {
+		if _, err := ParseBytes(s); err == nil {
+			t.Errorf("parse %s should fail", s)
+		}
+	}
+}
+
+func TestUnmountedSubsystem(t *testing.T) {
+	if IsCgroup2UnifiedMode() {
+		t.Skip("all controllers share one hierarchy on cgroup v2")
+	}
+	dir, err := ioutil.TempDir("", "mydocker-cgroup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	wd, _ := os.Getwd()
+	os.Chdir(dir)
+	defer os.Chdir(wd)
+
+	if _, err := GetCgroupPath("nosuchsubsys", "mydocker/test", true); err == nil {
+		t.Errorf("get cgroup path of unmounted subsystem should fail")
+	}
+	if _, err := os.Stat("mydocker"); !os.IsNotExist(err) {
+		t.Errorf("cgroup directory should not be created in the working directory")
+	}
+	if mounted, err := checkMounted("nosuchsubsys", false); mounted || err != nil {
+		t.Errorf("unmounted subsystem without limits should be skipped, got %v %v", mounted, err)
+	}
+	if _, err := checkMounted("nosuchsubsys", true); err == nil {
+		t.Errorf("unmounted subsystem with limits should fail")
+	}
+}
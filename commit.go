@@ -16,5 +16,20 @@ func commitContainer(containerName, imageName string){
 
 	if _, err := exec.Command("tar", "-czf", imageTar, "-C", mntURL, ".").CombinedOutput(); err != nil {
 		log.Errorf("Tar folder %s error %v", mntURL, err)
+		return
+	}
+
+	// 容器的用户和工作目录作为新镜像的默认配置
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		log.Errorf("Get container %s info error %v", containerName, err)
+		return
+	}
+	imageConfig := &container.ImageConfig{
+		User:       containerInfo.User,
+		WorkingDir: containerInfo.WorkingDir,
+	}
+	if err := container.SaveImageConfig(imageName, imageConfig); err != nil {
+		log.Errorf("Save image config %s error %v", imageName, err)
 	}
 }
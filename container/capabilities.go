@@ -0,0 +1,233 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+const (
+	linuxCapabilityVersion3 = 0x20080522
+	prCapAmbient            = 47
+	prCapAmbientRaise       = 2
+	prCapAmbientClearAll    = 4
+)
+
+var capabilityNames = map[string]uint{
+	"CAP_CHOWN":              0,
+	"CAP_DAC_OVERRIDE":       1,
+	"CAP_DAC_READ_SEARCH":    2,
+	"CAP_FOWNER":             3,
+	"CAP_FSETID":             4,
+	"CAP_KILL":               5,
+	"CAP_SETGID":             6,
+	"CAP_SETUID":             7,
+	"CAP_SETPCAP":            8,
+	"CAP_LINUX_IMMUTABLE":    9,
+	"CAP_NET_BIND_SERVICE":   10,
+	"CAP_NET_BROADCAST":      11,
+	"CAP_NET_ADMIN":          12,
+	"CAP_NET_RAW":            13,
+	"CAP_IPC_LOCK":           14,
+	"CAP_IPC_OWNER":          15,
+	"CAP_SYS_MODULE":         16,
+	"CAP_SYS_RAWIO":          17,
+	"CAP_SYS_CHROOT":         18,
+	"CAP_SYS_PTRACE":         19,
+	"CAP_SYS_PACCT":          20,
+	"CAP_SYS_ADMIN":          21,
+	"CAP_SYS_BOOT":           22,
+	"CAP_SYS_NICE":           23,
+	"CAP_SYS_RESOURCE":       24,
+	"CAP_SYS_TIME":           25,
+	"CAP_SYS_TTY_CONFIG":     26,
+	"CAP_MKNOD":              27,
+	"CAP_LEASE":              28,
+	"CAP_AUDIT_WRITE":        29,
+	"CAP_AUDIT_CONTROL":      30,
+	"CAP_SETFCAP":            31,
+	"CAP_MAC_OVERRIDE":       32,
+	"CAP_MAC_ADMIN":          33,
+	"CAP_SYSLOG":             34,
+	"CAP_WAKE_ALARM":         35,
+	"CAP_BLOCK_SUSPEND":      36,
+	"CAP_AUDIT_READ":         37,
+	"CAP_PERFMON":            38,
+	"CAP_BPF":                39,
+	"CAP_CHECKPOINT_RESTORE": 40,
+}
+
+// 参考 docker 的默认 capability 白名单
+var DefaultCapabilities = []string{
+	"CAP_CHOWN",
+	"CAP_DAC_OVERRIDE",
+	"CAP_FSETID",
+	"CAP_FOWNER",
+	"CAP_MKNOD",
+	"CAP_NET_RAW",
+	"CAP_SETGID",
+	"CAP_SETUID",
+	"CAP_SETFCAP",
+	"CAP_SETPCAP",
+	"CAP_NET_BIND_SERVICE",
+	"CAP_SYS_CHROOT",
+	"CAP_KILL",
+	"CAP_AUDIT_WRITE",
+}
+
+// 根据 --cap-add/--cap-drop/--privileged 计算容器最终拥有的 capability
+func TweakCapabilities(capAdd, capDrop []string, privileged bool) ([]string, error) {
+	caps := map[string]bool{}
+	base := DefaultCapabilities
+	if privileged {
+		base = allCapabilities()
+	}
+	for _, name := range base {
+		caps[name] = true
+	}
+	for _, name := range capAdd {
+		if strings.ToUpper(name) == "ALL" {
+			for _, c := range allCapabilities() {
+				caps[c] = true
+			}
+			continue
+		}
+		c, err := normalizeCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		caps[c] = true
+	}
+	for _, name := range capDrop {
+		if strings.ToUpper(name) == "ALL" {
+			caps = map[string]bool{}
+			continue
+		}
+		c, err := normalizeCapability(name)
+		if err != nil {
+			return nil, err
+		}
+		delete(caps, c)
+	}
+
+	// 全部去掉时返回空集合而不是 nil, 保存到容器信息中是 [] 而不是 null
+	result := []string{}
+	for c := range caps {
+		result = append(result, c)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return capabilityNames[result[i]] < capabilityNames[result[j]]
+	})
+	return result, nil
+}
+
+// 把 capability 名字转换成位图, exec 时通过环境变量传给 nsenter
+func CapabilityMask(caps []string) (uint64, error) {
+	var mask uint64
+	for _, name := range caps {
+		c, err := normalizeCapability(name)
+		if err != nil {
+			return 0, err
+		}
+		mask |= 1 << capabilityNames[c]
+	}
+	return mask, nil
+}
+
+func normalizeCapability(name string) (string, error) {
+	c := strings.ToUpper(name)
+	if !strings.HasPrefix(c, "CAP_") {
+		c = "CAP_" + c
+	}
+	if _, ok := capabilityNames[c]; !ok {
+		return "", fmt.Errorf("unknown capability %s", name)
+	}
+	return c, nil
+}
+
+func allCapabilities() []string {
+	lastCap := lastCapability()
+	var caps []string
+	for name, c := range capabilityNames {
+		if c <= lastCap {
+			caps = append(caps, name)
+		}
+	}
+	return caps
+}
+
+// 内核支持的最大 capability 编号
+func lastCapability() uint {
+	content, err := ioutil.ReadFile("/proc/sys/kernel/cap_last_cap")
+	if err != nil {
+		return capabilityNames["CAP_AUDIT_READ"]
+	}
+	last, err := strconv.Atoi(strings.TrimSpace(string(content)))
+	if err != nil {
+		return capabilityNames["CAP_AUDIT_READ"]
+	}
+	return uint(last)
+}
+
+type capHeader struct {
+	version uint32
+	pid     int32
+}
+
+type capData struct {
+	effective   uint32
+	permitted   uint32
+	inheritable uint32
+}
+
+// 在 exec 用户进程之前设置当前线程的 capability:
+// 先收缩 bounding 集合, 切换到容器进程的用户, 再设置 effective/permitted/inheritable, 最后设置 ambient
+// 和 docker 一致, 非 root 用户不设置 ambient, exec 之后不再拥有 capability
+func applyCapabilities(caps []string, user *ExecUser) error {
+	mask, err := CapabilityMask(caps)
+	if err != nil {
+		return err
+	}
+	lastCap := lastCapability()
+
+	for c := uint(0); c <= lastCap; c++ {
+		if mask&(1<<c) != 0 {
+			continue
+		}
+		if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_CAPBSET_DROP, uintptr(c), 0); errno != 0 {
+			return fmt.Errorf("drop bounding capability %d error %v", c, errno)
+		}
+	}
+
+	if err := setupUser(user); err != nil {
+		return err
+	}
+
+	header := capHeader{version: linuxCapabilityVersion3}
+	data := [2]capData{}
+	for i := range data {
+		set := uint32(mask >> (32 * uint(i)))
+		data[i] = capData{effective: set, permitted: set, inheritable: set}
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_CAPSET, uintptr(unsafe.Pointer(&header)), uintptr(unsafe.Pointer(&data[0])), 0); errno != 0 {
+		return fmt.Errorf("capset error %v", errno)
+	}
+
+	// 老内核不支持 ambient capability, 清空失败时直接跳过
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientClearAll, 0, 0, 0, 0); errno != 0 || user.Uid != 0 {
+		return nil
+	}
+	for c := uint(0); c <= lastCap; c++ {
+		if mask&(1<<c) == 0 {
+			continue
+		}
+		if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prCapAmbient, prCapAmbientRaise, uintptr(c), 0, 0, 0); errno != 0 {
+			return fmt.Errorf("raise ambient capability %d error %v", c, errno)
+		}
+	}
+	return nil
+}
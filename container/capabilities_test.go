@@ -0,0 +1,47 @@
+package container
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTweakCapabilities(t *testing.T) {
+	caps, err := TweakCapabilities([]string{"net_admin"}, []string{"CAP_MKNOD", "chown"}, false)
+	if err != nil {
+		t.Fatalf("tweak capabilities %v", err)
+	}
+	mask, _ := CapabilityMask(caps)
+	if mask&(1<<capabilityNames["CAP_NET_ADMIN"]) == 0 {
+		t.Fatalf("CAP_NET_ADMIN should be added: %v", caps)
+	}
+	if mask&(1<<capabilityNames["CAP_MKNOD"]) != 0 || mask&(1<<capabilityNames["CAP_CHOWN"]) != 0 {
+		t.Fatalf("CAP_MKNOD and CAP_CHOWN should be dropped: %v", caps)
+	}
+
+	caps, _ = TweakCapabilities(nil, []string{"all"}, false)
+	if len(caps) != 0 {
+		t.Fatalf("all capabilities should be dropped: %v", caps)
+	}
+
+	if _, err := TweakCapabilities([]string{"CAP_NOT_EXIST"}, nil, false); err == nil {
+		t.Fatalf("unknown capability should fail")
+	}
+}
+
+func TestDropAllCapabilitiesJSON(t *testing.T) {
+	caps, err := TweakCapabilities(nil, []string{"all"}, false)
+	if err != nil {
+		t.Fatalf("tweak capabilities %v", err)
+	}
+	content, err := json.Marshal(&ContainerInfo{Capabilities: caps, CapabilitiesSet: true})
+	if err != nil {
+		t.Fatalf("marshal container info %v", err)
+	}
+	var info ContainerInfo
+	if err := json.Unmarshal(content, &info); err != nil {
+		t.Fatalf("unmarshal container info %v", err)
+	}
+	if info.Capabilities == nil || len(info.Capabilities) != 0 || !info.CapabilitiesSet {
+		t.Fatalf("dropped capabilities should be an empty set, got %s", content)
+	}
+}
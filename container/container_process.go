@@ -3,12 +3,14 @@ package container
 import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/cgroups/subsystems"
 	"os"
 	"os/exec"
 	"syscall"
 )
 
 var (
+	CREATED             string = "created"
 	RUNNING             string = "running"
 	STOP                string = "stopped"
 	Exit                string = "exited"
@@ -21,17 +23,56 @@ var (
 )
 
 type ContainerInfo struct {
-	Pid         string `json:"pid"`        //容器的init进程在宿主机上的 PID
-	Id          string `json:"id"`         //容器Id
-	Name        string `json:"name"`       //容器名
-	Command     string `json:"command"`    //容器内init运行命令
-	CreatedTime string `json:"createTime"` //创建时间
-	Status      string `json:"status"`     //容器的状态
-	Volume      string `json:"volume"`     //容器的数据卷
-	PortMapping []string `json:"portmapping"` //端口映射
+	Pid               string                     `json:"pid"`                   //容器的init进程在宿主机上的 PID
+	Id                string                     `json:"id"`                    //容器Id
+	Name              string                     `json:"name"`                  //容器名
+	Command           string                     `json:"command"`               //容器内init运行命令
+	CreatedTime       string                     `json:"createTime"`            //创建时间
+	Status            string                     `json:"status"`                //容器的状态
+	OOMKilled         bool                       `json:"oomKilled"`             //容器中是否有进程被 OOM killer 杀掉
+	Mounts            []Mount                    `json:"mounts"`                //数据卷和其他挂载
+	PortMapping       []string                   `json:"portmapping"`           //端口映射
+	Image             string                     `json:"image"`                 //容器使用的镜像
+	UidMappings       []IDMap                    `json:"uidMappings,omitempty"` //user namespace 的 uid 映射
+	GidMappings       []IDMap                    `json:"gidMappings,omitempty"` //user namespace 的 gid 映射
+	Capabilities      []string                   `json:"capabilities"`          //容器进程的 capability 集合
+	CapabilitiesSet   bool                       `json:"capabilitiesSet"`       //init 进程是否按 Capabilities 收缩了权限, 老版本创建的容器为 false
+	Seccomp           string                     `json:"seccomp"`               //seccomp 配置, default/unconfined 或配置文件路径
+	NoNewPrivileges   bool                       `json:"noNewPrivileges"`       //是否禁止进程获取新的权限
+	ReadonlyRootfs    bool                       `json:"readonlyRootfs"`        //rootfs 是否只读
+	Tmpfs             []string                   `json:"tmpfs"`                 //挂载的可写 tmpfs
+	MaskedPaths       []string                   `json:"maskedPaths"`           //屏蔽的路径
+	ReadonlyPaths     []string                   `json:"readonlyPaths"`         //只读的路径
+	ShmSize           string                     `json:"shmSize"`               ///dev/shm 的大小
+	Hostname          string                     `json:"hostname"`              //容器的主机名
+	IPAddress         string                     `json:"ip,omitempty"`          //容器在网络中分配到的 IP
+	Dns               []string                   `json:"dns"`                   //DNS 服务器
+	DnsSearch         []string                   `json:"dnsSearch"`             //DNS 搜索域
+	DnsOptions        []string                   `json:"dnsOptions"`            //resolv.conf 的 options
+	ExtraHosts        []string                   `json:"extraHosts"`            //额外写入 /etc/hosts 的 host:ip
+	User              string                     `json:"user"`                  //运行用户进程的 user[:group]
+	WorkingDir        string                     `json:"workingDir"`            //用户进程的工作目录
+	Ulimits           []Rlimit                   `json:"ulimits"`               //容器进程的资源限制
+	OomScoreAdj       int                        `json:"oomScoreAdj"`           //init 进程的 oom_score_adj
+	NetMode           string                     `json:"netMode"`               //network namespace 模式, 空、host 或 container:<name>
+	PidMode           string                     `json:"pidMode"`               //pid namespace 模式
+	IpcMode           string                     `json:"ipcMode"`               //ipc namespace 模式
+	UtsMode           string                     `json:"utsMode"`               //uts namespace 模式
+	CgroupnsMode      string                     `json:"cgroupnsMode"`          //cgroup namespace 模式, private 或 host
+	TimeOffsets       map[string]TimeOffset      `json:"timeOffsets,omitempty"` //time namespace 的时钟偏移, 为空时不创建 time namespace
+	Sysctls           map[string]string          `json:"sysctls"`               //容器 namespace 中的 sysctl
+	Devices           []Device                   `json:"devices"`               //--device 指定的设备
+	DeviceCgroupRules []string                   `json:"deviceCgroupRules"`     //额外的 devices cgroup 规则
+	CgroupParent      string                     `json:"cgroupParent"`          //容器的 cgroup 所在的父 cgroup, 为空时使用 /mydocker
+	CgroupPath        string                     `json:"cgroupPath"`            //容器的 cgroup 相对于 hierarchy 根目录的路径
+	Resources         *subsystems.ResourceConfig `json:"resources,omitempty"`   //cgroup 的资源限制
+	Bundle            string                     `json:"bundle,omitempty"`      //OCI bundle 目录, 为空时不是通过 oci create 创建的容器
+	Rootfs            string                     `json:"rootfs,omitempty"`      //OCI bundle 中的 rootfs, 为空时使用镜像创建 aufs 工作目录
+	Annotations       map[string]string          `json:"annotations,omitempty"` //OCI 配置中的 annotations
+	Hooks             Hooks                      `json:"hooks"`                 //全局和容器自己的 hook
 }
 
-func NewParentProcess(tty bool, containerName, volume, imageName string, envSlice []string) (*exec.Cmd, *os.File) {
+func NewParentProcess(tty bool, containerInfo *ContainerInfo, envSlice []string) (*exec.Cmd, *os.File) {
 	readPipe, writePipe, err := NewPipe()
 	if err != nil {
 		log.Errorf("New pipe error %v", err)
@@ -45,16 +86,24 @@ func NewParentProcess(tty bool, containerName, volume, imageName string, envSlic
 
 	cmd := exec.Command(initCmd, "init")
 	cmd.SysProcAttr = &syscall.SysProcAttr{
-		Cloneflags: syscall.CLONE_NEWUTS | syscall.CLONE_NEWPID | syscall.CLONE_NEWNS |
-			syscall.CLONE_NEWNET | syscall.CLONE_NEWIPC,
+		Cloneflags: namespaceCloneFlags(containerInfo),
+	}
+	if len(containerInfo.UidMappings) > 0 {
+		cmd.SysProcAttr.Cloneflags |= syscall.CLONE_NEWUSER
+		cmd.SysProcAttr.UidMappings = toSysProcIDMap(containerInfo.UidMappings)
+		cmd.SysProcAttr.GidMappings = toSysProcIDMap(containerInfo.GidMappings)
+		cmd.SysProcAttr.GidMappingsEnableSetgroups = true
+		// 以 user namespace 中的 root 身份启动 init 进程, 否则在新的 namespace 中没有任何 capability
+		cmd.SysProcAttr.Credential = &syscall.Credential{Uid: 0, Gid: 0}
 	}
 
-	if tty {
+	// OCI 容器的标准输入输出由调用方提供, 直接继承
+	if tty || containerInfo.Bundle != "" {
 		cmd.Stdin = os.Stdin
 		cmd.Stdout = os.Stdout
 		cmd.Stderr = os.Stderr
 	} else {
-		dirURL := fmt.Sprintf(DefaultInfoLocation, containerName)
+		dirURL := fmt.Sprintf(DefaultInfoLocation, containerInfo.Name)
 		if err := os.MkdirAll(dirURL, 0622); err != nil {
 			log.Errorf("NewParentProcess mkdir %s error %v", dirURL, err)
 			return nil, nil
@@ -70,8 +119,29 @@ func NewParentProcess(tty bool, containerName, volume, imageName string, envSlic
 
 	cmd.ExtraFiles = []*os.File{readPipe}
 	cmd.Env = append(os.Environ(), envSlice...)
-	NewWorkSpace(volume, imageName, containerName)
-	cmd.Dir = fmt.Sprintf(MntUrl, containerName)
+	if containerInfo.Bundle != "" {
+		execFifo, err := newExecFifo(containerInfo.Name)
+		if err != nil {
+			log.Errorf("New exec fifo error %v", err)
+			return nil, nil
+		}
+		cmd.ExtraFiles = append(cmd.ExtraFiles, execFifo)
+		// OCI 容器只使用配置文件中的环境变量
+		cmd.Env = envSlice
+	}
+	if containerInfo.Rootfs != "" {
+		if err := prepareMountSources(containerInfo.Mounts, containerInfo.UidMappings, containerInfo.GidMappings); err != nil {
+			log.Errorf("Prepare mount sources error %v", err)
+			return nil, nil
+		}
+		cmd.Dir = containerInfo.Rootfs
+		return cmd, writePipe
+	}
+	if err := NewWorkSpace(containerInfo); err != nil {
+		log.Errorf("New workspace error %v", err)
+		return nil, nil
+	}
+	cmd.Dir = fmt.Sprintf(MntUrl, containerInfo.Name)
 	return cmd, writePipe
 }
 
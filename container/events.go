@@ -0,0 +1,80 @@
+package container
+
+import (
+	"bufio"
+	"encoding/json"
+	log "github.com/Sirupsen/logrus"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// 容器生命周期中的事件按行追加到 EventsLog 中, 每行是一个 json 格式的 Event
+var EventsLog = "/var/run/mydocker/events.log"
+
+const (
+	EventStart   = "start"
+	EventOOM     = "oom"
+	EventDie     = "die"
+	EventStop    = "stop"
+	EventUpdate  = "update"
+	EventDestroy = "destroy"
+)
+
+type Event struct {
+	Time   string `json:"time"`
+	Id     string `json:"id"`
+	Name   string `json:"name"`
+	Action string `json:"action"`
+}
+
+// 记录事件失败不影响容器的运行, 只打印警告
+func RecordEvent(containerInfo *ContainerInfo, action string) {
+	event := Event{
+		Time:   time.Now().Format("2006-01-02 15:04:05"),
+		Id:     containerInfo.Id,
+		Name:   containerInfo.Name,
+		Action: action,
+	}
+	content, err := json.Marshal(event)
+	if err != nil {
+		log.Warnf("Marshal event error %v", err)
+		return
+	}
+	if err := os.MkdirAll(filepath.Dir(EventsLog), 0622); err != nil {
+		log.Warnf("Mkdir %s error %v", filepath.Dir(EventsLog), err)
+		return
+	}
+	file, err := os.OpenFile(EventsLog, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		log.Warnf("Open events log %s error %v", EventsLog, err)
+		return
+	}
+	defer file.Close()
+	if _, err := file.Write(append(content, '\n')); err != nil {
+		log.Warnf("Write event error %v", err)
+	}
+}
+
+// 读取所有事件, 还没有事件时返回空
+func ReadEvents() ([]Event, error) {
+	file, err := os.Open(EventsLog)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		var event Event
+		if err := json.Unmarshal(scanner.Bytes(), &event); err != nil {
+			log.Warnf("Invalid event %s", scanner.Text())
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, scanner.Err()
+}
@@ -0,0 +1,91 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"syscall"
+	"time"
+)
+
+const ExecFifoName = "exec.fifo"
+
+const (
+	// oci create 创建的 init 进程通过 fd 4 上的 exec fifo 和 oci start 同步
+	execFifoFd = 4
+	// syscall 包中没有定义 O_PATH
+	oPath = 0x200000
+)
+
+func ExecFifoPath(containerName string) string {
+	return fmt.Sprintf(DefaultInfoLocation, containerName) + ExecFifoName
+}
+
+// 在状态目录中创建 exec fifo, 以 O_PATH 打开后传给 init 进程, init 进程再通过 /proc/self/fd 打开写端
+func newExecFifo(containerName string) (*os.File, error) {
+	path := ExecFifoPath(containerName)
+	if err := os.MkdirAll(fmt.Sprintf(DefaultInfoLocation, containerName), 0622); err != nil {
+		return nil, err
+	}
+	if err := syscall.Mkfifo(path, 0622); err != nil {
+		return nil, fmt.Errorf("mkfifo %s error %v", path, err)
+	}
+	// mkfifo 的权限受 umask 影响, user namespace 中的 root 需要能写入
+	if err := os.Chmod(path, 0622); err != nil {
+		return nil, err
+	}
+	return os.OpenFile(path, oPath|syscall.O_CLOEXEC, 0)
+}
+
+// 在 init 进程中打开 exec fifo 的写端, 一直阻塞到 oci start 打开读端
+// ExtraFiles 传进来的 fd 没有 CLOEXEC, 完成之后要关闭, 不能泄漏到用户进程中
+func waitExecFifo(fd int) error {
+	fifo, err := os.OpenFile(fmt.Sprintf("/proc/self/fd/%d", fd), os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("open exec fifo error %v", err)
+	}
+	defer fifo.Close()
+	if _, err := fifo.Write([]byte("0")); err != nil {
+		return fmt.Errorf("write exec fifo error %v", err)
+	}
+	if err := syscall.Close(fd); err != nil {
+		return fmt.Errorf("close exec fifo error %v", err)
+	}
+	return nil
+}
+
+// 读取 exec fifo, 让阻塞在 created 状态的 init 进程继续执行用户命令
+// 打开读端会阻塞到 init 进程打开写端, 期间 init 进程退出时返回错误
+func StartExecFifo(containerName string, pid int) error {
+	path := ExecFifoPath(containerName)
+	if _, err := os.Stat(path); err != nil {
+		return fmt.Errorf("container %s has already been started", containerName)
+	}
+	result := make(chan error, 1)
+	go func() {
+		fifo, err := os.OpenFile(path, os.O_RDONLY, 0)
+		if err != nil {
+			result <- err
+			return
+		}
+		defer fifo.Close()
+		data, err := ioutil.ReadAll(fifo)
+		if err == nil && len(data) == 0 {
+			err = fmt.Errorf("container %s init process exited before start", containerName)
+		}
+		result <- err
+	}()
+	for {
+		select {
+		case err := <-result:
+			if err != nil {
+				return err
+			}
+			return os.Remove(path)
+		case <-time.After(100 * time.Millisecond):
+			if err := syscall.Kill(pid, 0); err != nil {
+				return fmt.Errorf("container %s init process exited before start", containerName)
+			}
+		}
+	}
+}
@@ -0,0 +1,44 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestWaitExecFifoClosesFd(t *testing.T) {
+	dir, err := ioutil.TempDir("", "execfifo")
+	if err != nil {
+		t.Fatalf("create temp dir %v", err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, ExecFifoName)
+	if err := syscall.Mkfifo(path, 0622); err != nil {
+		t.Fatalf("mkfifo %v", err)
+	}
+	fd, err := syscall.Open(path, oPath|syscall.O_CLOEXEC, 0)
+	if err != nil {
+		t.Fatalf("open exec fifo %v", err)
+	}
+	result := make(chan error, 1)
+	go func() {
+		data, err := ioutil.ReadFile(path)
+		if err == nil && string(data) != "0" {
+			err = fmt.Errorf("read %q from exec fifo", data)
+		}
+		result <- err
+	}()
+	if err := waitExecFifo(fd); err != nil {
+		t.Fatalf("wait exec fifo %v", err)
+	}
+	if err := <-result; err != nil {
+		t.Fatalf("read exec fifo %v", err)
+	}
+	// fd 已经关闭, 即使编号被重新使用也不会再指向 exec fifo
+	if target, err := os.Readlink(fmt.Sprintf("/proc/self/fd/%d", fd)); err == nil && target == path {
+		t.Errorf("exec fifo fd %d is still open", fd)
+	}
+}
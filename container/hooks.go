@@ -0,0 +1,143 @@
+package container
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 全局的 hook 配置, 对所有容器生效, 在容器自己的 hook 之前执行
+var GlobalHooksFile = "/etc/mydocker/hooks.json"
+
+// 宿主机上执行的命令, 超时时间单位为秒
+type Hook struct {
+	Path    string   `json:"path"`
+	Args    []string `json:"args,omitempty"`
+	Env     []string `json:"env,omitempty"`
+	Timeout *int     `json:"timeout,omitempty"`
+}
+
+// 容器生命周期中执行的 hook, 格式和 OCI runtime-spec 的 hooks 相同
+type Hooks struct {
+	Prestart  []Hook `json:"prestart,omitempty"`  //网络配置完成之后, 用户命令运行之前
+	Poststart []Hook `json:"poststart,omitempty"` //用户命令运行之后, 失败时只记录日志
+	Poststop  []Hook `json:"poststop,omitempty"`  //容器进程退出之后, 失败时只记录日志
+}
+
+// 通过标准输入传给 hook 的容器状态, 格式和 OCI runtime-spec 的 state 相同
+type State struct {
+	Version     string            `json:"ociVersion"`
+	ID          string            `json:"id"`
+	Status      string            `json:"status"`
+	Pid         int               `json:"pid,omitempty"`
+	Bundle      string            `json:"bundle"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+}
+
+func LoadHooks(path string) (*Hooks, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read hooks %s error %v", path, err)
+	}
+	var hooks Hooks
+	if err := json.Unmarshal(content, &hooks); err != nil {
+		return nil, fmt.Errorf("decode hooks %s error %v", path, err)
+	}
+	if err := ValidateHooks(&hooks); err != nil {
+		return nil, err
+	}
+	return &hooks, nil
+}
+
+// 加载全局 hook 配置, 配置文件不存在时没有全局 hook
+func LoadGlobalHooks() (*Hooks, error) {
+	if _, err := os.Stat(GlobalHooksFile); os.IsNotExist(err) {
+		return &Hooks{}, nil
+	}
+	return LoadHooks(GlobalHooksFile)
+}
+
+func ValidateHooks(hooks *Hooks) error {
+	for _, list := range [][]Hook{hooks.Prestart, hooks.Poststart, hooks.Poststop} {
+		for _, hook := range list {
+			if !filepath.IsAbs(hook.Path) {
+				return fmt.Errorf("hook path %s must be absolute", hook.Path)
+			}
+			if hook.Timeout != nil && *hook.Timeout <= 0 {
+				return fmt.Errorf("hook %s timeout must be positive", hook.Path)
+			}
+		}
+	}
+	return nil
+}
+
+// 把 other 中的 hook 追加到 h 之后
+func (h *Hooks) Append(other *Hooks) {
+	h.Prestart = append(h.Prestart, other.Prestart...)
+	h.Poststart = append(h.Poststart, other.Poststart...)
+	h.Poststop = append(h.Poststop, other.Poststop...)
+}
+
+// 依次执行 hook, 任意一个失败时返回错误
+func RunHooks(hooks []Hook, state *State) error {
+	stateBytes, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	for _, hook := range hooks {
+		if err := runHook(hook, stateBytes); err != nil {
+			return fmt.Errorf("run hook %s error %v", hook.Path, err)
+		}
+	}
+	return nil
+}
+
+func runHook(hook Hook, state []byte) error {
+	var output bytes.Buffer
+	cmd := &exec.Cmd{
+		Path:   hook.Path,
+		Args:   hook.Args,
+		Env:    hook.Env,
+		Stdin:  bytes.NewReader(state),
+		Stdout: &output,
+		Stderr: &output,
+		// 超时的时候杀死整个进程组, 否则 hook 的子进程会一直占用输出管道
+		SysProcAttr: &syscall.SysProcAttr{Setpgid: true},
+	}
+	if len(cmd.Args) == 0 {
+		cmd.Args = []string{hook.Path}
+	}
+	// 按照 OCI 的约定, 没有配置 env 时 hook 的环境变量为空, 不继承 mydocker 的环境变量
+	if cmd.Env == nil {
+		cmd.Env = []string{}
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	done := make(chan error, 1)
+	go func() {
+		done <- cmd.Wait()
+	}()
+	var timeout <-chan time.Time
+	if hook.Timeout != nil {
+		timeout = time.After(time.Duration(*hook.Timeout) * time.Second)
+	}
+	select {
+	case err := <-done:
+		if err != nil {
+			return fmt.Errorf("%v: %s", err, strings.TrimSpace(output.String()))
+		}
+		return nil
+	case <-timeout:
+		syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		<-done
+		return fmt.Errorf("timeout after %d seconds", *hook.Timeout)
+	}
+}
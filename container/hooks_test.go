@@ -0,0 +1,68 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLoadHooks(t *testing.T) {
+	f, err := ioutil.TempFile("", "mydocker-hooks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	f.WriteString(`{"prestart":[{"path":"/usr/bin/register","args":["register","--ip"],"timeout":5}],"poststop":[{"path":"/usr/bin/snapshot"}]}`)
+	f.Close()
+
+	hooks, err := LoadHooks(f.Name())
+	if err != nil {
+		t.Fatalf("load hooks %v", err)
+	}
+	if len(hooks.Prestart) != 1 || *hooks.Prestart[0].Timeout != 5 || len(hooks.Poststop) != 1 {
+		t.Errorf("load hooks got %+v", hooks)
+	}
+	global := &Hooks{Prestart: []Hook{{Path: "/usr/bin/global"}}}
+	global.Append(hooks)
+	if len(global.Prestart) != 2 || global.Prestart[0].Path != "/usr/bin/global" || len(global.Poststop) != 1 {
+		t.Errorf("append hooks got %+v", global)
+	}
+
+	timeout := 0
+	for _, hooks := range []*Hooks{
+		{Prestart: []Hook{{Path: "register"}}},
+		{Poststop: []Hook{{Path: "/usr/bin/snapshot", Timeout: &timeout}}},
+	} {
+		if err := ValidateHooks(hooks); err == nil {
+			t.Errorf("hooks %+v should be invalid", hooks)
+		}
+	}
+}
+
+func TestRunHooks(t *testing.T) {
+	state := &State{Version: "1.0.2", ID: "abc", Status: "created", Pid: 1, Bundle: "/bundle"}
+	hooks := []Hook{{Path: "/bin/sh", Args: []string{"sh", "-c", `grep -q '"id":"abc"'`}}}
+	if err := RunHooks(hooks, state); err != nil {
+		t.Errorf("run hooks %v", err)
+	}
+	timeout := 1
+	hooks = []Hook{{Path: "/bin/sh", Args: []string{"sh", "-c", "sleep 5"}, Timeout: &timeout}}
+	if err := RunHooks(hooks, state); err == nil {
+		t.Errorf("hook should time out")
+	}
+	// 没有配置 env 时不继承当前进程的环境变量
+	os.Setenv("MYDOCKER_HOOK_TEST", "1")
+	defer os.Unsetenv("MYDOCKER_HOOK_TEST")
+	hooks = []Hook{{Path: "/bin/sh", Args: []string{"sh", "-c", `test -z "$MYDOCKER_HOOK_TEST"`}}}
+	if err := RunHooks(hooks, state); err != nil {
+		t.Errorf("hook should not inherit environment: %v", err)
+	}
+	hooks = []Hook{{Path: "/bin/sh", Args: []string{"sh", "-c", `test "$FOO" = bar`}, Env: []string{"FOO=bar"}}}
+	if err := RunHooks(hooks, state); err != nil {
+		t.Errorf("hook should get configured env: %v", err)
+	}
+	hooks = []Hook{{Path: "/bin/false"}}
+	if err := RunHooks(hooks, state); err == nil {
+		t.Errorf("failed hook should return error")
+	}
+}
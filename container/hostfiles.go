@@ -0,0 +1,195 @@
+package container
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+var (
+	HostResolvConf = "/etc/resolv.conf"
+	// 宿主机上没有可用的 nameserver 时使用的默认 DNS
+	DefaultDns = []string{"8.8.8.8", "8.8.4.4"}
+)
+
+// 由 mydocker 生成并 bind mount 到容器 /etc 下的文件
+var hostFiles = []string{"hostname", "hosts", "resolv.conf"}
+
+var hostnamePattern = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?(\.[a-zA-Z0-9]([a-zA-Z0-9-]{0,61}[a-zA-Z0-9])?)*$`)
+
+func ValidateHostname(hostname string) error {
+	if len(hostname) > 64 || !hostnamePattern.MatchString(hostname) {
+		return fmt.Errorf("invalid hostname %s", hostname)
+	}
+	return nil
+}
+
+func ValidateDns(dns string) error {
+	if net.ParseIP(dns) == nil {
+		return fmt.Errorf("invalid dns server %s", dns)
+	}
+	return nil
+}
+
+// 解析 --add-host host:ip 参数, ip 可以是 IPv6 地址
+func ParseExtraHost(spec string) (string, string, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	if len(parts) != 2 || parts[0] == "" {
+		return "", "", fmt.Errorf("invalid extra host %s, should be host:ip", spec)
+	}
+	if net.ParseIP(parts[1]) == nil {
+		return "", "", fmt.Errorf("invalid ip address %s in extra host %s", parts[1], spec)
+	}
+	return parts[0], parts[1], nil
+}
+
+// 在容器的状态目录下生成 hostname、hosts 和 resolv.conf, 返回所在的目录
+func SetupHostFiles(containerInfo *ContainerInfo) (string, error) {
+	dirUrl := fmt.Sprintf(DefaultInfoLocation, containerInfo.Name)
+	if err := os.MkdirAll(dirUrl, 0622); err != nil {
+		return "", fmt.Errorf("mkdir %s error %v", dirUrl, err)
+	}
+	hostResolv, err := ioutil.ReadFile(HostResolvConf)
+	if err != nil && !os.IsNotExist(err) {
+		return "", fmt.Errorf("read %s error %v", HostResolvConf, err)
+	}
+	hosts, err := buildHosts(containerInfo.Hostname, containerInfo.IPAddress, containerInfo.ExtraHosts)
+	if err != nil {
+		return "", err
+	}
+	contents := map[string][]byte{
+		"hostname":    []byte(containerInfo.Hostname + "\n"),
+		"hosts":       hosts,
+		"resolv.conf": buildResolvConf(hostResolv, containerInfo.Dns, containerInfo.DnsSearch, containerInfo.DnsOptions),
+	}
+
+	rootUid, rootGid := 0, 0
+	if len(containerInfo.UidMappings) > 0 {
+		// user namespace 中的 root 需要能访问状态目录并修改这些文件
+		rootUid, _ = HostID(containerInfo.UidMappings, 0)
+		rootGid, _ = HostID(containerInfo.GidMappings, 0)
+		if err := ensureSearchable(rootUid, filepath.Dir(filepath.Clean(dirUrl)), dirUrl); err != nil {
+			return "", err
+		}
+	}
+	for _, name := range hostFiles {
+		path := filepath.Join(dirUrl, name)
+		if err := ioutil.WriteFile(path, contents[name], 0644); err != nil {
+			return "", fmt.Errorf("write %s error %v", path, err)
+		}
+		if err := os.Chown(path, rootUid, rootGid); err != nil {
+			return "", fmt.Errorf("chown %s error %v", path, err)
+		}
+	}
+	return dirUrl, nil
+}
+
+func buildHosts(hostname, ip string, extraHosts []string) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteString("127.0.0.1\tlocalhost\n")
+	buf.WriteString("::1\tlocalhost ip6-localhost ip6-loopback\n")
+	buf.WriteString("fe00::0\tip6-localnet\n")
+	buf.WriteString("ff00::0\tip6-mcastprefix\n")
+	buf.WriteString("ff02::1\tip6-allnodes\n")
+	buf.WriteString("ff02::2\tip6-allrouters\n")
+	for _, spec := range extraHosts {
+		host, hostIP, err := ParseExtraHost(spec)
+		if err != nil {
+			return nil, err
+		}
+		fmt.Fprintf(&buf, "%s\t%s\n", hostIP, host)
+	}
+	// 容器没有连接网络时没有 IP, 只能把 hostname 解析到回环地址
+	if ip == "" {
+		ip = "127.0.0.1"
+	}
+	fmt.Fprintf(&buf, "%s\t%s\n", ip, hostname)
+	return buf.Bytes(), nil
+}
+
+// 在宿主机 resolv.conf 的基础上生成容器的 resolv.conf, 参数中指定的配置覆盖宿主机的配置
+// 容器在自己的 network namespace 中访问不到宿主机回环地址上的 DNS, 需要去掉这些 nameserver
+func buildResolvConf(hostResolv []byte, dns, dnsSearch, dnsOptions []string) []byte {
+	var hostDns, hostSearch, hostOptions []string
+	scanner := bufio.NewScanner(bytes.NewReader(hostResolv))
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "nameserver":
+			if ip := net.ParseIP(fields[1]); ip != nil && !ip.IsLoopback() {
+				hostDns = append(hostDns, fields[1])
+			}
+		case "search", "domain":
+			hostSearch = fields[1:]
+		case "options":
+			hostOptions = append(hostOptions, fields[1:]...)
+		}
+	}
+
+	if len(dns) == 0 {
+		dns = hostDns
+		if len(dns) == 0 {
+			dns = DefaultDns
+		}
+	}
+	if len(dnsSearch) == 0 {
+		dnsSearch = hostSearch
+	} else if len(dnsSearch) == 1 && dnsSearch[0] == "." {
+		// --dns-search=. 表示不使用 search domain
+		dnsSearch = nil
+	}
+	if len(dnsOptions) == 0 {
+		dnsOptions = hostOptions
+	}
+
+	var buf bytes.Buffer
+	for _, ns := range dns {
+		fmt.Fprintf(&buf, "nameserver %s\n", ns)
+	}
+	if len(dnsSearch) > 0 {
+		fmt.Fprintf(&buf, "search %s\n", strings.Join(dnsSearch, " "))
+	}
+	if len(dnsOptions) > 0 {
+		fmt.Fprintf(&buf, "options %s\n", strings.Join(dnsOptions, " "))
+	}
+	return buf.Bytes()
+}
+
+// 在 pivot_root 之前把生成的文件 bind mount 到容器的 /etc 下, 镜像中没有对应文件时先创建
+func mountHostFiles(rootfs, dir string) error {
+	if dir == "" {
+		return nil
+	}
+	etcPath := filepath.Join(rootfs, "etc")
+	if err := os.MkdirAll(etcPath, 0755); err != nil {
+		return err
+	}
+	for _, name := range hostFiles {
+		dest := filepath.Join(etcPath, name)
+		// 镜像中的文件可能是指向宿主机路径的软链接, 直接替换
+		if info, err := os.Lstat(dest); err == nil && info.Mode()&os.ModeSymlink != 0 {
+			if err := os.Remove(dest); err != nil {
+				return err
+			}
+		}
+		f, err := os.OpenFile(dest, os.O_CREATE, 0644)
+		if err != nil {
+			return fmt.Errorf("create %s error %v", dest, err)
+		}
+		f.Close()
+		if err := syscall.Mount(filepath.Join(dir, name), dest, "bind", syscall.MS_BIND, ""); err != nil {
+			return fmt.Errorf("bind %s error %v", name, err)
+		}
+	}
+	return nil
+}
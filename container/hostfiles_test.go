@@ -0,0 +1,46 @@
+package container
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestBuildResolvConf(t *testing.T) {
+	host := []byte("# generated\nnameserver 127.0.0.53\nnameserver 10.0.0.2\nsearch example.com\noptions edns0\n")
+
+	got := string(buildResolvConf(host, nil, nil, nil))
+	want := "nameserver 10.0.0.2\nsearch example.com\noptions edns0\n"
+	if got != want {
+		t.Errorf("inherit host resolv.conf got %q want %q", got, want)
+	}
+
+	got = string(buildResolvConf(host, []string{"1.1.1.1"}, []string{"."}, []string{"ndots:2"}))
+	want = "nameserver 1.1.1.1\noptions ndots:2\n"
+	if got != want {
+		t.Errorf("override resolv.conf got %q want %q", got, want)
+	}
+
+	got = string(buildResolvConf([]byte("nameserver 127.0.0.1\n"), nil, nil, nil))
+	want = "nameserver 8.8.8.8\nnameserver 8.8.4.4\n"
+	if got != want {
+		t.Errorf("loopback only resolv.conf got %q want %q", got, want)
+	}
+}
+
+func TestBuildHosts(t *testing.T) {
+	hosts, err := buildHosts("web", "192.168.10.2", []string{"db:192.168.10.3", "v6:fe80::1"})
+	if err != nil {
+		t.Fatalf("build hosts %v", err)
+	}
+	for _, line := range []string{"127.0.0.1\tlocalhost\n", "192.168.10.3\tdb\n", "fe80::1\tv6\n", "192.168.10.2\tweb\n"} {
+		if !strings.Contains(string(hosts), line) {
+			t.Errorf("hosts missing %q:\n%s", line, hosts)
+		}
+	}
+
+	for _, spec := range []string{"db", ":1.2.3.4", "db:999.1.1.1"} {
+		if _, _, err := ParseExtraHost(spec); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package container
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+)
+
+// 镜像的元数据, 和镜像 tar 包一起保存在 RootUrl 下, 为容器提供默认配置
+type ImageConfig struct {
+	User       string `json:"user,omitempty"`       //默认运行用户 user[:group]
+	WorkingDir string `json:"workingDir,omitempty"` //默认工作目录
+}
+
+func ImageConfigUrl(imageName string) string {
+	return RootUrl + "/" + imageName + ".json"
+}
+
+// 读取镜像的元数据, 镜像没有元数据时返回空配置
+func LoadImageConfig(imageName string) (*ImageConfig, error) {
+	config := &ImageConfig{}
+	contentBytes, err := ioutil.ReadFile(ImageConfigUrl(imageName))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return config, nil
+		}
+		return nil, err
+	}
+	if err := json.Unmarshal(contentBytes, config); err != nil {
+		return nil, fmt.Errorf("unmarshal image config %s error %v", imageName, err)
+	}
+	return config, nil
+}
+
+func SaveImageConfig(imageName string, config *ImageConfig) error {
+	contentBytes, err := json.Marshal(config)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(ImageConfigUrl(imageName), contentBytes, 0644)
+}
@@ -1,23 +1,91 @@
 package container
 
 import (
+	"encoding/json"
 	"fmt"
 	log "github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/seccomp"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
-	"strings"
+	"runtime"
 	"syscall"
 )
 
+// 父进程通过管道传给容器init进程的配置
+type InitConfig struct {
+	Args            []string          `json:"args"`            //用户命令
+	Capabilities    []string          `json:"capabilities"`    //容器进程保留的capability
+	Seccomp         *seccomp.Seccomp  `json:"seccomp"`         //seccomp配置, 为空时不过滤系统调用
+	ReadonlyRootfs  bool              `json:"readonlyRootfs"`  //是否以只读方式挂载rootfs
+	Tmpfs           []string          `json:"tmpfs"`           //额外挂载的可写tmpfs
+	NoNewPrivileges bool              `json:"noNewPrivileges"` //是否设置 no_new_privs
+	MaskedPaths     []string          `json:"maskedPaths"`     //屏蔽的路径
+	ReadonlyPaths   []string          `json:"readonlyPaths"`   //只读的路径
+	ShmSize         string            `json:"shmSize"`         ///dev/shm 的大小
+	Hostname        string            `json:"hostname"`        //容器的主机名
+	HostFilesDir    string            `json:"hostFilesDir"`    //宿主机上生成的 hostname/hosts/resolv.conf 所在目录
+	User            string            `json:"user"`            //运行用户进程的 user[:group]
+	WorkingDir      string            `json:"workingDir"`      //用户进程的工作目录
+	Rlimits         []Rlimit          `json:"rlimits"`         //资源限制
+	CgroupNamespace bool              `json:"cgroupNamespace"` //是否创建 cgroup namespace
+	Sysctls         map[string]string `json:"sysctls"`         //需要写入的 sysctl
+	Devices         []Device          `json:"devices"`         //--device 指定的设备
+	Mounts          []Mount           `json:"mounts"`          //数据卷和其他挂载
+	ExecFifo        bool              `json:"execFifo"`        //是否在执行用户命令之前等待 oci start
+}
+
 func RunContainerInitProcess() error {
-	cmdArray := readUserCommand()
-	if cmdArray == nil || len(cmdArray) == 0 {
+	// capability 等属性是线程级别的, 需要保证设置和 exec 在同一个线程中完成
+	runtime.LockOSThread()
+
+	config := readInitConfig()
+	if config == nil || len(config.Args) == 0 {
 		return fmt.Errorf("Run container get user command error, cmdArray is nil")
 	}
+	cmdArray := config.Args
 
-	setUpMount()
+	// 父进程在 cgroup 设置完成之后才发送配置, 此时创建 cgroup namespace, 容器内看到的 cgroup 根就是自己的 cgroup
+	if config.CgroupNamespace {
+		if err := syscall.Unshare(syscall.CLONE_NEWCGROUP); err != nil {
+			log.Errorf("Unshare cgroup namespace error %v", err)
+			return err
+		}
+	}
+	if config.Hostname != "" {
+		if err := syscall.Sethostname([]byte(config.Hostname)); err != nil {
+			log.Errorf("Set hostname error %v", err)
+			return err
+		}
+	}
+	if err := setUpMount(config); err != nil {
+		log.Errorf("Set up mount error %v", err)
+		return err
+	}
+	// pivot_root 之后才能读到容器自己的 /etc/passwd 和 /etc/group
+	user, err := ResolveUser(config.User, "/etc/passwd", "/etc/group")
+	if err != nil {
+		log.Errorf("Resolve user %s error %v", config.User, err)
+		return err
+	}
+	if err := setupWorkingDir(config.WorkingDir, user); err != nil {
+		log.Errorf("Set up working dir error %v", err)
+		return err
+	}
+	// 工作目录不存在时需要在 rootfs 中创建, 所以创建之后才把 rootfs 重新挂载为只读
+	// pivotRoot 时 rootfs 已经 bind mount 到自身, 直接重新挂载即可
+	if config.ReadonlyRootfs {
+		if err := remountBind("/", syscall.MS_RDONLY); err != nil {
+			log.Errorf("Remount rootfs readonly error %v", err)
+			return err
+		}
+	}
+
+	if err := setRlimits(config.Rlimits); err != nil {
+		log.Errorf("Set rlimits error %v", err)
+		return err
+	}
 
 	path, err := exec.LookPath(cmdArray[0])
 	if err != nil {
@@ -25,13 +93,42 @@ func RunContainerInitProcess() error {
 		return err
 	}
 	log.Infof("Find path %s", path)
+	if config.NoNewPrivileges {
+		if err := setNoNewPrivileges(); err != nil {
+			log.Errorf("Set no new privileges error %v", err)
+			return err
+		}
+	}
+	// 在丢弃 CAP_SYS_ADMIN 之前安装 seccomp 过滤器, 这样不需要 no_new_privs
+	if config.Seccomp != nil {
+		filter, err := seccomp.Compile(config.Seccomp, config.Capabilities)
+		if err != nil {
+			log.Errorf("Compile seccomp profile error %v", err)
+			return err
+		}
+		if err := seccomp.InstallFilter(filter); err != nil {
+			log.Errorf("Install seccomp filter error %v", err)
+			return err
+		}
+	}
+	if err := applyCapabilities(config.Capabilities, user); err != nil {
+		log.Errorf("Apply capabilities error %v", err)
+		return err
+	}
+	// 所有设置完成之后才等待 start, start 之后只剩下 exec 用户命令
+	if config.ExecFifo {
+		if err := waitExecFifo(execFifoFd); err != nil {
+			log.Errorf("Wait exec fifo error %v", err)
+			return err
+		}
+	}
 	if err := syscall.Exec(path, cmdArray[0:], os.Environ()); err != nil {
 		log.Errorf(err.Error())
 	}
 	return nil
 }
 
-func readUserCommand() []string {
+func readInitConfig() *InitConfig {
 	pipe := os.NewFile(uintptr(3), "pipe")
 	defer pipe.Close()
 	msg, err := ioutil.ReadAll(pipe)
@@ -39,27 +136,67 @@ func readUserCommand() []string {
 		log.Errorf("init read pipe error %v", err)
 		return nil
 	}
-	msgStr := string(msg)
-	return strings.Split(msgStr, " ")
+	var config InitConfig
+	if err := json.Unmarshal(msg, &config); err != nil {
+		log.Errorf("init unmarshal config error %v", err)
+		return nil
+	}
+	return &config
 }
 
 /**
 Init 挂载点
 */
-func setUpMount() {
+func setUpMount(config *InitConfig) error {
 	pwd, err := os.Getwd()
 	if err != nil {
 		log.Errorf("Get current location error %v", err)
-		return
+		return err
 	}
 	log.Infof("Current location is %s", pwd)
-	pivotRoot(pwd)
 
-	//mount proc
+	// 容器内的挂载不要传播回宿主机
+	if err := syscall.Mount("", "/", "", rootPropagation(config.Mounts), ""); err != nil {
+		return fmt.Errorf("make / private error %v", err)
+	}
+	if err := setupDev(pwd, config.ShmSize, config.Devices); err != nil {
+		return err
+	}
+	if err := mountSys(pwd); err != nil {
+		return err
+	}
+	if err := mountHostFiles(pwd, config.HostFilesDir); err != nil {
+		return err
+	}
+	if err := mountAll(pwd, config.Mounts); err != nil {
+		return err
+	}
+
+	//mount proc, user namespace 中要求挂载时宿主机的 proc 仍然可见, 所以在 pivot_root 之前挂载
 	defaultMountFlags := syscall.MS_NOEXEC | syscall.MS_NOSUID | syscall.MS_NODEV
-	syscall.Mount("proc", "/proc", "proc", uintptr(defaultMountFlags), "")
+	procPath := filepath.Join(pwd, "proc")
+	if err := os.MkdirAll(procPath, 0555); err != nil {
+		return err
+	}
+	if err := syscall.Mount("proc", procPath, "proc", uintptr(defaultMountFlags), ""); err != nil {
+		return fmt.Errorf("mount proc error %v", err)
+	}
+
+	if err := pivotRoot(pwd); err != nil {
+		return err
+	}
 
-	syscall.Mount("tmpfs", "/dev", "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755")
+	if err := mountTmpfs(config.Tmpfs); err != nil {
+		return err
+	}
+	// 父进程在发送配置之前已经配置好网络, 这里写入 sysctl 之后 /proc/sys 才会变成只读
+	if err := writeSysctls(config.Sysctls); err != nil {
+		return err
+	}
+	if err := maskPaths(config.MaskedPaths); err != nil {
+		return err
+	}
+	return readonlyPaths(config.ReadonlyPaths)
 }
 
 func pivotRoot(root string) error {
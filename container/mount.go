@@ -0,0 +1,356 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+const (
+	MountTypeBind   = "bind"
+	MountTypeTmpfs  = "tmpfs"
+	MountTypeVolume = "volume"
+)
+
+var VolumeUrl = "/root/volumes/%s"
+
+var mountPropagations = map[string]uintptr{
+	"rprivate": syscall.MS_PRIVATE | syscall.MS_REC,
+	"private":  syscall.MS_PRIVATE,
+	"rshared":  syscall.MS_SHARED | syscall.MS_REC,
+	"shared":   syscall.MS_SHARED,
+	"rslave":   syscall.MS_SLAVE | syscall.MS_REC,
+	"slave":    syscall.MS_SLAVE,
+}
+
+// 容器内的一个挂载
+type Mount struct {
+	Type        string `json:"type"`                  //bind, tmpfs 或 volume
+	Source      string `json:"source"`                //bind 为宿主机路径, volume 为卷名, tmpfs 为空
+	Destination string `json:"destination"`           //容器内的路径
+	ReadOnly    bool   `json:"readOnly"`              //是否只读
+	Propagation string `json:"propagation,omitempty"` //bind mount 的传播类型, 默认 rprivate
+	TmpfsSize   string `json:"tmpfsSize,omitempty"`   //tmpfs 的大小
+
+	createSource bool //-v 指定的宿主机目录不存在时自动创建
+}
+
+// 解析 -v src:dst[:ro|rw] 参数, src 是绝对路径时为 bind mount, 否则为数据卷的名字
+func ParseVolume(spec string) (*Mount, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, fmt.Errorf("invalid volume %s, should be src:dst[:ro|rw]", spec)
+	}
+	m := &Mount{Type: MountTypeVolume, Source: parts[0], Destination: parts[1]}
+	if filepath.IsAbs(parts[0]) {
+		m.Type, m.createSource = MountTypeBind, true
+	}
+	if len(parts) == 3 {
+		for _, opt := range strings.Split(parts[2], ",") {
+			switch opt {
+			case "ro":
+				m.ReadOnly = true
+			case "rw":
+				m.ReadOnly = false
+			default:
+				if _, ok := mountPropagations[opt]; !ok {
+					return nil, fmt.Errorf("invalid volume option %s", opt)
+				}
+				m.Propagation = opt
+			}
+		}
+	}
+	return m, m.Validate()
+}
+
+// 解析 --mount type=bind|tmpfs|volume,src=,dst=,readonly,bind-propagation=,tmpfs-size= 参数
+func ParseMount(spec string) (*Mount, error) {
+	m := &Mount{Type: MountTypeVolume}
+	for _, field := range strings.Split(spec, ",") {
+		kv := strings.SplitN(field, "=", 2)
+		key, value := kv[0], ""
+		if len(kv) == 2 {
+			value = kv[1]
+		}
+		switch key {
+		case "type":
+			m.Type = value
+		case "src", "source":
+			m.Source = value
+		case "dst", "destination", "target":
+			m.Destination = value
+		case "readonly", "ro":
+			m.ReadOnly = value == "" || value == "true" || value == "1"
+		case "bind-propagation":
+			m.Propagation = value
+		case "tmpfs-size":
+			m.TmpfsSize = value
+		default:
+			return nil, fmt.Errorf("unknown mount option %s", key)
+		}
+	}
+	return m, m.Validate()
+}
+
+// 检查挂载配置, 同时规范化容器内的路径
+func (m *Mount) Validate() error {
+	if !filepath.IsAbs(m.Destination) {
+		return fmt.Errorf("mount destination %s must be absolute", m.Destination)
+	}
+	m.Destination = filepath.Clean(m.Destination)
+	if m.Destination == "/" {
+		return fmt.Errorf("mount destination can not be /")
+	}
+	switch m.Type {
+	case MountTypeBind:
+		if !filepath.IsAbs(m.Source) {
+			return fmt.Errorf("bind source %s must be absolute", m.Source)
+		}
+		if _, err := os.Stat(m.Source); err != nil && !(m.createSource && os.IsNotExist(err)) {
+			return fmt.Errorf("bind source %s error %v", m.Source, err)
+		}
+	case MountTypeVolume:
+		if m.Source == "" || strings.Contains(m.Source, "/") || m.Source == "." || m.Source == ".." {
+			return fmt.Errorf("invalid volume name %s", m.Source)
+		}
+	case MountTypeTmpfs:
+		if m.Source != "" {
+			return fmt.Errorf("tmpfs mount does not support source")
+		}
+		if m.TmpfsSize != "" {
+			if err := ValidateShmSize(m.TmpfsSize); err != nil {
+				return fmt.Errorf("invalid tmpfs size %s", m.TmpfsSize)
+			}
+		}
+	default:
+		return fmt.Errorf("invalid mount type %s", m.Type)
+	}
+	if m.Type != MountTypeBind && m.Propagation != "" {
+		return fmt.Errorf("propagation is only supported by bind mounts")
+	}
+	if _, ok := mountPropagations[m.Propagation]; m.Propagation != "" && !ok {
+		return fmt.Errorf("invalid propagation %s", m.Propagation)
+	}
+	if m.Type != MountTypeTmpfs && m.TmpfsSize != "" {
+		return fmt.Errorf("tmpfs-size is only supported by tmpfs mounts")
+	}
+	return nil
+}
+
+func VolumePath(name string) string {
+	return fmt.Sprintf(VolumeUrl, name)
+}
+
+// 在宿主机上准备挂载源: 创建数据卷目录和 -v 指定的不存在的目录, user namespace 中新建的目录属于容器的 root
+func prepareMountSources(mounts []Mount, uidMaps, gidMaps []IDMap) error {
+	for _, m := range mounts {
+		var source string
+		switch {
+		case m.Type == MountTypeVolume:
+			source = VolumePath(m.Source)
+		case m.Type == MountTypeBind && m.createSource:
+			source = m.Source
+		default:
+			continue
+		}
+		if m.Type == MountTypeVolume && len(uidMaps) > 0 {
+			rootUid, _ := HostID(uidMaps, 0)
+			if err := ensureSearchable(rootUid, filepath.Dir(filepath.Dir(source)), filepath.Dir(source)); err != nil {
+				return err
+			}
+		}
+		if _, err := os.Stat(source); err == nil {
+			continue
+		}
+		if err := os.MkdirAll(source, 0755); err != nil {
+			return fmt.Errorf("mkdir mount source %s error %v", source, err)
+		}
+		if len(uidMaps) > 0 {
+			rootUid, _ := HostID(uidMaps, 0)
+			rootGid, _ := HostID(gidMaps, 0)
+			if err := os.Chown(source, rootUid, rootGid); err != nil {
+				return fmt.Errorf("chown mount source %s error %v", source, err)
+			}
+		}
+	}
+	return nil
+}
+
+// 有挂载需要和宿主机之间传播时, 容器的根挂载点使用 rslave 而不是 rprivate, 否则宿主机上的挂载不会传播进来
+func rootPropagation(mounts []Mount) uintptr {
+	for _, m := range mounts {
+		if m.Propagation != "" && !strings.HasSuffix(m.Propagation, "private") {
+			return syscall.MS_SLAVE | syscall.MS_REC
+		}
+	}
+	return syscall.MS_PRIVATE | syscall.MS_REC
+}
+
+// 在 pivot_root 之前执行挂载, 目标路径在 rootfs 中解析, 路径中的软链接不会指向 rootfs 之外
+func mountAll(rootfs string, mounts []Mount) error {
+	for _, m := range mounts {
+		dest, err := securePath(rootfs, m.Destination)
+		if err != nil {
+			return err
+		}
+		if m.Type == MountTypeTmpfs {
+			if err := os.MkdirAll(dest, 0755); err != nil {
+				return fmt.Errorf("mkdir mount destination %s error %v", m.Destination, err)
+			}
+			flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV)
+			if m.ReadOnly {
+				flags |= syscall.MS_RDONLY
+			}
+			data := "mode=1777"
+			if m.TmpfsSize != "" {
+				data += ",size=" + m.TmpfsSize
+			}
+			if err := syscall.Mount("tmpfs", dest, "tmpfs", flags, data); err != nil {
+				return fmt.Errorf("mount tmpfs %s error %v", m.Destination, err)
+			}
+			continue
+		}
+
+		source := m.Source
+		if m.Type == MountTypeVolume {
+			source = VolumePath(m.Source)
+		}
+		if err := createMountPoint(source, dest); err != nil {
+			return fmt.Errorf("create mount point %s error %v", m.Destination, err)
+		}
+		if err := syscall.Mount(source, dest, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+			return fmt.Errorf("bind %s to %s error %v", source, m.Destination, err)
+		}
+		if m.ReadOnly {
+			if err := remountBindRecursive(dest, syscall.MS_RDONLY); err != nil {
+				return err
+			}
+		}
+		propagation := m.Propagation
+		if propagation == "" {
+			propagation = "rprivate"
+		}
+		if err := syscall.Mount("", dest, "", mountPropagations[propagation], ""); err != nil {
+			return fmt.Errorf("set propagation %s of %s error %v", propagation, m.Destination, err)
+		}
+	}
+	return nil
+}
+
+// MS_REC 的 bind mount 会带上源目录下的子挂载, 重新挂载只对一个挂载点生效, 所以每个子挂载都要重新挂载
+func remountBindRecursive(dest string, flags uintptr) error {
+	f, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	mountPoints, err := parseSubmounts(f, dest)
+	if err != nil {
+		return fmt.Errorf("read mountinfo error %v", err)
+	}
+	for _, mountPoint := range mountPoints {
+		if err := remountBind(mountPoint, flags); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 从 mountinfo 中找出 dest 以及它下面的挂载点, 第 5 列是挂载点, 其中的空格等字符用八进制转义
+func parseSubmounts(r io.Reader, dest string) ([]string, error) {
+	var mountPoints []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 5 {
+			continue
+		}
+		mountPoint := unescapeMountPath(fields[4])
+		if mountPoint == dest || strings.HasPrefix(mountPoint, dest+"/") {
+			mountPoints = append(mountPoints, mountPoint)
+		}
+	}
+	return mountPoints, scanner.Err()
+}
+
+func unescapeMountPath(s string) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if c, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(c))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
+
+// 挂载源是文件时创建空文件作为挂载点, 否则创建目录
+func createMountPoint(source, dest string) error {
+	info, err := os.Stat(source)
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return os.MkdirAll(dest, 0755)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// 把容器内的路径解析成 rootfs 下的路径, 软链接按照 rootfs 作为根目录解析
+func securePath(root, unsafePath string) (string, error) {
+	current := "/"
+	remaining := unsafePath
+	for links := 0; remaining != ""; {
+		var part string
+		remaining = strings.TrimLeft(remaining, "/")
+		if i := strings.IndexByte(remaining, '/'); i >= 0 {
+			part, remaining = remaining[:i], remaining[i:]
+		} else {
+			part, remaining = remaining, ""
+		}
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+		next := filepath.Join(current, part)
+		info, err := os.Lstat(filepath.Join(root, next))
+		if err != nil || info.Mode()&os.ModeSymlink == 0 {
+			if err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+			current = next
+			continue
+		}
+		if links++; links > 255 {
+			return "", fmt.Errorf("too many symlinks in %s", unsafePath)
+		}
+		target, err := os.Readlink(filepath.Join(root, next))
+		if err != nil {
+			return "", err
+		}
+		if filepath.IsAbs(target) {
+			current = "/"
+		}
+		remaining = target + "/" + remaining
+	}
+	return filepath.Join(root, current), nil
+}
@@ -0,0 +1,100 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParseMount(t *testing.T) {
+	m, err := ParseVolume("/tmp:/data:ro")
+	if err != nil {
+		t.Fatalf("parse volume %v", err)
+	}
+	if m.Type != MountTypeBind || m.Source != "/tmp" || m.Destination != "/data" || !m.ReadOnly {
+		t.Errorf("parse volume got %+v", *m)
+	}
+	m, err = ParseVolume("cache:/var/cache/")
+	if err != nil || m.Type != MountTypeVolume || m.Source != "cache" || m.Destination != "/var/cache" {
+		t.Errorf("parse named volume got %+v %v", m, err)
+	}
+
+	m, err = ParseMount("type=bind,src=/tmp,dst=/data,readonly,bind-propagation=rslave")
+	if err != nil {
+		t.Fatalf("parse mount %v", err)
+	}
+	if *m != (Mount{Type: MountTypeBind, Source: "/tmp", Destination: "/data", ReadOnly: true, Propagation: "rslave"}) {
+		t.Errorf("parse mount got %+v", *m)
+	}
+	m, err = ParseMount("type=tmpfs,dst=/run,tmpfs-size=64m")
+	if err != nil || m.Type != MountTypeTmpfs || m.TmpfsSize != "64m" {
+		t.Errorf("parse tmpfs mount got %+v %v", m, err)
+	}
+
+	for _, spec := range []string{"/data", "/tmp:data", "/tmp:/data:rx", "a/b:/data"} {
+		if _, err := ParseVolume(spec); err == nil {
+			t.Errorf("parse volume %s should fail", spec)
+		}
+	}
+	for _, spec := range []string{
+		"type=bind,src=/not-exist-dir,dst=/data",
+		"type=tmpfs,src=/tmp,dst=/data",
+		"type=volume,src=cache,dst=/data,bind-propagation=rshared",
+		"type=bind,src=/tmp,dst=/",
+		"type=nfs,src=/tmp,dst=/data",
+		"type=bind,src=/tmp,dst=/data,size=1",
+	} {
+		if _, err := ParseMount(spec); err == nil {
+			t.Errorf("parse mount %s should fail", spec)
+		}
+	}
+}
+
+func TestSecurePath(t *testing.T) {
+	root, err := ioutil.TempDir("", "mydocker-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "var/lib"), 0755)
+	os.Symlink("/etc", filepath.Join(root, "abs"))
+	os.Symlink("../../..", filepath.Join(root, "var/lib/up"))
+	os.Symlink("lib", filepath.Join(root, "var/rel"))
+
+	cases := map[string]string{
+		"/data":           "/data",
+		"/abs/passwd":     "/etc/passwd",
+		"/var/lib/up/etc": "/etc",
+		"/var/rel/x":      "/var/lib/x",
+		"/../../x":        "/x",
+	}
+	for path, want := range cases {
+		got, err := securePath(root, path)
+		if err != nil {
+			t.Fatalf("secure path %s %v", path, err)
+		}
+		if got != filepath.Join(root, want) {
+			t.Errorf("secure path %s got %s want %s", path, got, filepath.Join(root, want))
+		}
+	}
+}
+
+func TestParseSubmounts(t *testing.T) {
+	mountinfo := `22 1 8:1 / / rw,relatime shared:1 - ext4 /dev/sda1 rw
+30 22 8:1 /data /rootfs/data rw,relatime - ext4 /dev/sda1 rw
+31 30 0:40 / /rootfs/data/cache rw,relatime - tmpfs tmpfs rw
+32 30 0:41 / /rootfs/data/my\040dir rw,relatime - tmpfs tmpfs rw
+33 22 0:42 / /rootfs/database rw,relatime - tmpfs tmpfs rw
+`
+	got, err := parseSubmounts(strings.NewReader(mountinfo), "/rootfs/data")
+	if err != nil {
+		t.Fatalf("parse submounts %v", err)
+	}
+	want := []string{"/rootfs/data", "/rootfs/data/cache", "/rootfs/data/my dir"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parse submounts got %q, want %q", got, want)
+	}
+}
@@ -0,0 +1,150 @@
+package container
+
+import (
+	"fmt"
+	"github.com/vishvananda/netns"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+const (
+	NamespaceModeHost      = "host"
+	NamespaceModePrivate   = "private"
+	namespaceModeContainer = "container:"
+)
+
+// --net/--pid/--ipc/--uts 参数为空时创建新的 namespace, host 表示使用宿主机的 namespace,
+// container:<name> 表示加入已有容器的 namespace, 绝对路径表示加入 namespace 文件对应的 namespace
+func ValidateNamespaceMode(mode string) error {
+	if mode == "" || mode == NamespaceModeHost || filepath.IsAbs(mode) {
+		return nil
+	}
+	if name := NamespaceContainer(mode); name != "" {
+		return nil
+	}
+	return fmt.Errorf("invalid namespace mode %s, should be host, container:<name> or a namespace path", mode)
+}
+
+// 返回 container:<name> 模式中的容器名, 其他模式返回空
+func NamespaceContainer(mode string) string {
+	if !strings.HasPrefix(mode, namespaceModeContainer) {
+		return ""
+	}
+	return strings.TrimPrefix(mode, namespaceModeContainer)
+}
+
+// 根据各个 namespace 的模式计算 init 进程的 clone flags, 非空的模式不创建新的 namespace
+func namespaceCloneFlags(containerInfo *ContainerInfo) uintptr {
+	flags := uintptr(syscall.CLONE_NEWNS)
+	modes := []struct {
+		mode string
+		flag uintptr
+	}{
+		{containerInfo.UtsMode, syscall.CLONE_NEWUTS},
+		{containerInfo.PidMode, syscall.CLONE_NEWPID},
+		{containerInfo.NetMode, syscall.CLONE_NEWNET},
+		{containerInfo.IpcMode, syscall.CLONE_NEWIPC},
+	}
+	for _, m := range modes {
+		if m.mode == "" {
+			flags |= m.flag
+		}
+	}
+	return flags
+}
+
+// 启动 init 进程, nsPaths 是需要加入的其他容器的 namespace 文件
+// setns 只对当前线程生效, 所以在锁定线程的 goroutine 中加入 namespace 后再 fork,
+// goroutine 退出时不解锁线程, 线程随之销毁, 不会把 namespace 带给其他 goroutine
+// 需要 time namespace 时同样在这个线程中 unshare, 写入时钟偏移后再 fork, init 进程创建时就进入新的 time namespace
+func StartParentProcess(cmd *exec.Cmd, nsPaths []string, timeOffsets map[string]TimeOffset) error {
+	if len(nsPaths) == 0 && len(timeOffsets) == 0 {
+		return cmd.Start()
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		runtime.LockOSThread()
+		for _, path := range nsPaths {
+			if err := setns(path); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		if len(timeOffsets) > 0 {
+			if err := unshareTimeNamespace(timeOffsets); err != nil {
+				errCh <- err
+				return
+			}
+		}
+		errCh <- cmd.Start()
+	}()
+	return <-errCh
+}
+
+func setns(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := netns.Setns(netns.NsHandle(f.Fd()), 0); err != nil {
+		return fmt.Errorf("setns %s error %v", path, err)
+	}
+	return nil
+}
+
+// time namespace 中时钟的偏移
+type TimeOffset struct {
+	Secs     int64  `json:"secs"`
+	Nanosecs uint32 `json:"nanosecs"`
+}
+
+// 解析 --time-offset monotonic=<duration>,boottime=<duration> 参数, duration 可以是秒数或者 1h30m 这样的格式
+func ParseTimeOffsets(spec string) (map[string]TimeOffset, error) {
+	offsets := map[string]TimeOffset{}
+	for _, item := range strings.Split(spec, ",") {
+		kv := strings.SplitN(item, "=", 2)
+		if len(kv) != 2 || (kv[0] != "monotonic" && kv[0] != "boottime") {
+			return nil, fmt.Errorf("invalid time offset %s, should be monotonic=<duration> or boottime=<duration>", item)
+		}
+		d, err := time.ParseDuration(kv[1])
+		if err != nil {
+			secs, err := strconv.ParseInt(kv[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid time offset duration %s", kv[1])
+			}
+			d = time.Duration(secs) * time.Second
+		}
+		// 内核要求纳秒部分非负, 负的偏移向下取整到秒
+		secs, nanos := int64(d/time.Second), int64(d%time.Second)
+		if nanos < 0 {
+			secs, nanos = secs-1, nanos+int64(time.Second)
+		}
+		offsets[kv[0]] = TimeOffset{Secs: secs, Nanosecs: uint32(nanos)}
+	}
+	return offsets, nil
+}
+
+// 为当前线程之后创建的子进程准备新的 time namespace, 偏移只能在还没有进程进入时写入
+func unshareTimeNamespace(timeOffsets map[string]TimeOffset) error {
+	if err := syscall.Unshare(syscall.CLONE_NEWTIME); err != nil {
+		return fmt.Errorf("unshare time namespace error %v", err)
+	}
+	var lines []string
+	for clock, offset := range timeOffsets {
+		lines = append(lines, fmt.Sprintf("%s %d %d", clock, offset.Secs, offset.Nanosecs))
+	}
+	// /proc/<pid>/timens_offsets 对应的是主线程, 需要通过线程 id 访问当前线程
+	path := fmt.Sprintf("/proc/%d/timens_offsets", syscall.Gettid())
+	if err := ioutil.WriteFile(path, []byte(strings.Join(lines, "\n")), 0644); err != nil {
+		return fmt.Errorf("write %s error %v", path, err)
+	}
+	return nil
+}
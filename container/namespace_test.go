@@ -0,0 +1,42 @@
+package container
+
+import (
+	"testing"
+)
+
+func TestParseTimeOffsets(t *testing.T) {
+	offsets, err := ParseTimeOffsets("monotonic=1h,boottime=-1.5s")
+	if err != nil {
+		t.Fatalf("parse time offsets %v", err)
+	}
+	if got := offsets["monotonic"]; got != (TimeOffset{Secs: 3600}) {
+		t.Errorf("monotonic offset %+v", got)
+	}
+	if got := offsets["boottime"]; got != (TimeOffset{Secs: -2, Nanosecs: 500000000}) {
+		t.Errorf("boottime offset %+v", got)
+	}
+
+	offsets, err = ParseTimeOffsets("boottime=86400")
+	if err != nil || offsets["boottime"] != (TimeOffset{Secs: 86400}) {
+		t.Errorf("parse seconds offset %+v %v", offsets, err)
+	}
+
+	for _, spec := range []string{"realtime=1h", "monotonic", "monotonic=abc"} {
+		if _, err := ParseTimeOffsets(spec); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+}
+
+func TestValidateNamespaceMode(t *testing.T) {
+	for _, mode := range []string{"", "host", "container:web", "/proc/1/ns/net"} {
+		if err := ValidateNamespaceMode(mode); err != nil {
+			t.Errorf("mode %q should be valid: %v", mode, err)
+		}
+	}
+	for _, mode := range []string{"private", "container:", "web"} {
+		if err := ValidateNamespaceMode(mode); err == nil {
+			t.Errorf("mode %q should be invalid", mode)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var rlimitNames = map[string]int{
+	"cpu":        0,
+	"fsize":      1,
+	"data":       2,
+	"stack":      3,
+	"core":       4,
+	"rss":        5,
+	"nproc":      6,
+	"nofile":     7,
+	"memlock":    8,
+	"as":         9,
+	"locks":      10,
+	"sigpending": 11,
+	"msgqueue":   12,
+	"nice":       13,
+	"rtprio":     14,
+	"rttime":     15,
+}
+
+// 容器进程的资源限制, -1 表示不限制
+type Rlimit struct {
+	Name string `json:"name"`
+	Soft int64  `json:"soft"`
+	Hard int64  `json:"hard"`
+}
+
+// 解析 --ulimit name=soft[:hard] 参数, 没有指定 hard 时和 soft 相同
+func ParseUlimit(spec string) (*Rlimit, error) {
+	parts := strings.SplitN(spec, "=", 2)
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid ulimit %s, should be name=soft[:hard]", spec)
+	}
+	if _, ok := rlimitNames[parts[0]]; !ok {
+		return nil, fmt.Errorf("invalid ulimit type %s", parts[0])
+	}
+	values := strings.SplitN(parts[1], ":", 2)
+	soft, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid ulimit soft value %s", values[0])
+	}
+	hard := soft
+	if len(values) == 2 {
+		if hard, err = strconv.ParseInt(values[1], 10, 64); err != nil {
+			return nil, fmt.Errorf("invalid ulimit hard value %s", values[1])
+		}
+	}
+	if soft < -1 || hard < -1 || (hard != -1 && (soft == -1 || soft > hard)) {
+		return nil, fmt.Errorf("ulimit soft limit must be less than or equal to hard limit: %s", spec)
+	}
+	return &Rlimit{Name: parts[0], Soft: soft, Hard: hard}, nil
+}
+
+func rlimitValue(v int64) uint64 {
+	if v == -1 {
+		return math.MaxUint64
+	}
+	return uint64(v)
+}
+
+// 在 init 进程中设置资源限制, 提高 hard limit 需要 CAP_SYS_RESOURCE, 所以要在丢弃 capability 之前调用
+func setRlimits(limits []Rlimit) error {
+	for _, limit := range limits {
+		rlimit := &syscall.Rlimit{Cur: rlimitValue(limit.Soft), Max: rlimitValue(limit.Hard)}
+		if err := syscall.Setrlimit(rlimitNames[limit.Name], rlimit); err != nil {
+			return fmt.Errorf("setrlimit %s error %v", limit.Name, err)
+		}
+	}
+	return nil
+}
+
+func ValidateOomScoreAdj(score int) error {
+	if score < -1000 || score > 1000 {
+		return fmt.Errorf("invalid oom score adj %d, should be in range [-1000, 1000]", score)
+	}
+	return nil
+}
+
+// 设置进程的 oom_score_adj, 容器内的进程会继承 init 进程的值
+func SetOomScoreAdj(pid, score int) error {
+	path := fmt.Sprintf("/proc/%d/oom_score_adj", pid)
+	if err := ioutil.WriteFile(path, []byte(strconv.Itoa(score)), 0644); err != nil {
+		return fmt.Errorf("write %s error %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package container
+
+import (
+	"testing"
+)
+
+func TestParseUlimit(t *testing.T) {
+	cases := map[string]Rlimit{
+		"nofile=1024:2048": {Name: "nofile", Soft: 1024, Hard: 2048},
+		"core=0":           {Name: "core", Soft: 0, Hard: 0},
+		"memlock=-1":       {Name: "memlock", Soft: -1, Hard: -1},
+		"nproc=100:-1":     {Name: "nproc", Soft: 100, Hard: -1},
+	}
+	for spec, want := range cases {
+		got, err := ParseUlimit(spec)
+		if err != nil {
+			t.Fatalf("parse %s %v", spec, err)
+		}
+		if *got != want {
+			t.Errorf("parse %s got %+v want %+v", spec, *got, want)
+		}
+	}
+
+	for _, spec := range []string{"nofile", "files=10", "nofile=a", "nofile=2048:1024", "nofile=-1:1024"} {
+		if _, err := ParseUlimit(spec); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+}
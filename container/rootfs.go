@@ -0,0 +1,363 @@
+package container
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"syscall"
+
+	"github.com/xianlubird/mydocker/cgroups/subsystems"
+)
+
+const prSetNoNewPrivs = 38
+
+// 默认屏蔽的敏感路径, 目录挂载空的只读 tmpfs, 文件挂载 /dev/null
+var DefaultMaskedPaths = []string{
+	"/proc/acpi",
+	"/proc/asound",
+	"/proc/kcore",
+	"/proc/keys",
+	"/proc/latency_stats",
+	"/proc/timer_list",
+	"/proc/timer_stats",
+	"/proc/sched_debug",
+	"/proc/scsi",
+	"/sys/firmware",
+	"/sys/devices/virtual/powercap",
+}
+
+// 默认只读的路径
+var DefaultReadonlyPaths = []string{
+	"/proc/bus",
+	"/proc/fs",
+	"/proc/irq",
+	"/proc/sys",
+	"/proc/sysrq-trigger",
+}
+
+var tmpfsFlags = map[string]struct {
+	clear bool
+	flag  uintptr
+}{
+	"ro":     {false, syscall.MS_RDONLY},
+	"rw":     {true, syscall.MS_RDONLY},
+	"nosuid": {false, syscall.MS_NOSUID},
+	"suid":   {true, syscall.MS_NOSUID},
+	"nodev":  {false, syscall.MS_NODEV},
+	"dev":    {true, syscall.MS_NODEV},
+	"noexec": {false, syscall.MS_NOEXEC},
+	"exec":   {true, syscall.MS_NOEXEC},
+}
+
+// 解析 --tmpfs /path[:options] 参数, 返回挂载点、挂载标志和 tmpfs 的数据参数
+func ParseTmpfs(spec string) (string, uintptr, string, error) {
+	parts := strings.SplitN(spec, ":", 2)
+	dest := parts[0]
+	if !filepath.IsAbs(dest) {
+		return "", 0, "", fmt.Errorf("tmpfs destination %s must be absolute", dest)
+	}
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	var data []string
+	if len(parts) == 2 {
+		for _, opt := range strings.Split(parts[1], ",") {
+			if opt == "" {
+				continue
+			}
+			if f, ok := tmpfsFlags[opt]; ok {
+				if f.clear {
+					flags &^= f.flag
+				} else {
+					flags |= f.flag
+				}
+				continue
+			}
+			data = append(data, opt)
+		}
+	}
+	return filepath.Clean(dest), flags, strings.Join(data, ","), nil
+}
+
+// 容器内的设备节点
+type Device struct {
+	Path        string      `json:"path"`                  //容器内的路径
+	Type        uint32      `json:"type"`                  //syscall.S_IFCHR 或 syscall.S_IFBLK
+	Major       int         `json:"major"`                 //主设备号
+	Minor       int         `json:"minor"`                 //次设备号
+	FileMode    os.FileMode `json:"fileMode"`              //权限
+	HostPath    string      `json:"hostPath,omitempty"`    //--device 指定的宿主机设备, 为空时和 Path 相同
+	Permissions string      `json:"permissions,omitempty"` //devices cgroup 中允许的访问方式 rwm
+}
+
+// 每个容器默认创建的设备
+var DefaultDevices = []Device{
+	{Path: "/dev/null", Type: syscall.S_IFCHR, Major: 1, Minor: 3, FileMode: 0666},
+	{Path: "/dev/zero", Type: syscall.S_IFCHR, Major: 1, Minor: 5, FileMode: 0666},
+	{Path: "/dev/full", Type: syscall.S_IFCHR, Major: 1, Minor: 7, FileMode: 0666},
+	{Path: "/dev/random", Type: syscall.S_IFCHR, Major: 1, Minor: 8, FileMode: 0666},
+	{Path: "/dev/urandom", Type: syscall.S_IFCHR, Major: 1, Minor: 9, FileMode: 0666},
+	{Path: "/dev/tty", Type: syscall.S_IFCHR, Major: 5, Minor: 0, FileMode: 0666},
+}
+
+var devSymlinks = [][2]string{
+	{"/proc/self/fd", "/dev/fd"},
+	{"/proc/self/fd/0", "/dev/stdin"},
+	{"/proc/self/fd/1", "/dev/stdout"},
+	{"/proc/self/fd/2", "/dev/stderr"},
+	{"pts/ptmx", "/dev/ptmx"},
+}
+
+// 解析 --device host[:container][:rwm] 参数, 设备号和权限从宿主机上的设备节点获取
+func ParseDevice(spec string) (*Device, error) {
+	parts := strings.Split(spec, ":")
+	if len(parts) > 3 {
+		return nil, fmt.Errorf("invalid device %s, should be host[:container][:rwm]", spec)
+	}
+	hostPath, containerPath, permissions := parts[0], parts[0], "rwm"
+	switch len(parts) {
+	case 2:
+		// 第二段不是路径时表示权限
+		if strings.HasPrefix(parts[1], "/") {
+			containerPath = parts[1]
+		} else {
+			permissions = parts[1]
+		}
+	case 3:
+		containerPath, permissions = parts[1], parts[2]
+	}
+	if !filepath.IsAbs(hostPath) || !filepath.IsAbs(containerPath) {
+		return nil, fmt.Errorf("device path %s must be absolute", spec)
+	}
+	// 权限为空时生成的 cgroup 规则无效, 和 --device-cgroup-rule 使用相同的检查
+	if err := subsystems.ValidateDeviceAccess(permissions); err != nil {
+		return nil, fmt.Errorf("invalid device permissions in %s: %v", spec, err)
+	}
+
+	var stat syscall.Stat_t
+	if err := syscall.Stat(hostPath, &stat); err != nil {
+		return nil, fmt.Errorf("stat device %s error %v", hostPath, err)
+	}
+	devType := stat.Mode & syscall.S_IFMT
+	if devType != syscall.S_IFCHR && devType != syscall.S_IFBLK {
+		return nil, fmt.Errorf("%s is not a device node", hostPath)
+	}
+	rdev := uint64(stat.Rdev)
+	return &Device{
+		Path:        filepath.Clean(containerPath),
+		Type:        devType,
+		Major:       int((rdev>>8)&0xfff | (rdev>>32)&^0xfff),
+		Minor:       int(rdev&0xff | (rdev>>12)&^0xff),
+		FileMode:    os.FileMode(stat.Mode & 0777),
+		HostPath:    hostPath,
+		Permissions: permissions,
+	}, nil
+}
+
+const DefaultShmSize = "64m"
+
+// tmpfs 的 size 参数支持字节数以及 k/m/g 后缀
+var shmSizePattern = regexp.MustCompile(`^[1-9][0-9]*[kKmMgG]?$`)
+
+func ValidateShmSize(size string) error {
+	if !shmSizePattern.MatchString(size) {
+		return fmt.Errorf("invalid shm size %s", size)
+	}
+	return nil
+}
+
+// 在 pivot_root 之前准备容器的 /dev: 新的 tmpfs 上创建默认设备和 --device 指定的设备、独立实例的 devpts、/dev/shm 和 /dev/mqueue
+func setupDev(rootfs, shmSize string, devices []Device) error {
+	devPath := filepath.Join(rootfs, "dev")
+	if err := os.MkdirAll(devPath, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("tmpfs", devPath, "tmpfs", syscall.MS_NOSUID|syscall.MS_STRICTATIME, "mode=755"); err != nil {
+		return fmt.Errorf("mount /dev error %v", err)
+	}
+	for i := range DefaultDevices {
+		if err := createDevice(rootfs, &DefaultDevices[i]); err != nil {
+			return err
+		}
+	}
+	for i := range devices {
+		if err := createDevice(rootfs, &devices[i]); err != nil {
+			return err
+		}
+	}
+
+	ptsPath := filepath.Join(devPath, "pts")
+	if err := os.MkdirAll(ptsPath, 0755); err != nil {
+		return err
+	}
+	ptsFlags := uintptr(syscall.MS_NOSUID | syscall.MS_NOEXEC)
+	if err := syscall.Mount("devpts", ptsPath, "devpts", ptsFlags, "newinstance,ptmxmode=0666,mode=0620,gid=5"); err != nil {
+		// user namespace 中没有映射 tty 组时去掉 gid 参数
+		if err := syscall.Mount("devpts", ptsPath, "devpts", ptsFlags, "newinstance,ptmxmode=0666,mode=0620"); err != nil {
+			return fmt.Errorf("mount devpts error %v", err)
+		}
+	}
+
+	if shmSize == "" {
+		shmSize = DefaultShmSize
+	}
+	shmPath := filepath.Join(devPath, "shm")
+	if err := os.MkdirAll(shmPath, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("shm", shmPath, "tmpfs", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, "mode=1777,size="+shmSize); err != nil {
+		return fmt.Errorf("mount /dev/shm error %v", err)
+	}
+
+	mqueuePath := filepath.Join(devPath, "mqueue")
+	if err := os.MkdirAll(mqueuePath, 0755); err != nil {
+		return err
+	}
+	if err := syscall.Mount("mqueue", mqueuePath, "mqueue", syscall.MS_NOSUID|syscall.MS_NODEV|syscall.MS_NOEXEC, ""); err != nil {
+		return fmt.Errorf("mount /dev/mqueue error %v", err)
+	}
+
+	for _, link := range devSymlinks {
+		if err := os.Symlink(link[0], filepath.Join(rootfs, link[1])); err != nil {
+			return fmt.Errorf("symlink %s error %v", link[1], err)
+		}
+	}
+	return nil
+}
+
+// 以只读方式挂载 sysfs, 在 user namespace 中不允许挂载时改为递归 bind mount 宿主机的 /sys
+func mountSys(rootfs string) error {
+	sysPath := filepath.Join(rootfs, "sys")
+	if err := os.MkdirAll(sysPath, 0755); err != nil {
+		return err
+	}
+	flags := uintptr(syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC | syscall.MS_RDONLY)
+	err := syscall.Mount("sysfs", sysPath, "sysfs", flags, "")
+	if err == nil {
+		return nil
+	}
+	if err != syscall.EPERM {
+		return fmt.Errorf("mount sysfs error %v", err)
+	}
+	if err := syscall.Mount("/sys", sysPath, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind /sys error %v", err)
+	}
+	// /sys 下面的 cgroup、securityfs 等子挂载也要只读
+	return remountBindRecursive(sysPath, syscall.MS_RDONLY)
+}
+
+// 创建设备节点, 在 user namespace 中没有权限 mknod 时改为 bind mount 宿主机上的设备
+func createDevice(rootfs string, device *Device) error {
+	// 设备路径在 rootfs 中解析, 镜像中的软链接不能把设备节点创建到 rootfs 之外
+	dest, err := securePath(rootfs, device.Path)
+	if err != nil {
+		return err
+	}
+	if !strings.HasPrefix(dest, filepath.Clean(rootfs)+"/") {
+		return fmt.Errorf("device %s is outside of rootfs", device.Path)
+	}
+	if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+		return err
+	}
+	dev := (device.Minor & 0xff) | (device.Major&0xfff)<<8 | (device.Minor&^0xff)<<12
+	err = syscall.Mknod(dest, device.Type|uint32(device.FileMode.Perm()), dev)
+	if err == nil {
+		return os.Chmod(dest, device.FileMode.Perm())
+	}
+	if err != syscall.EPERM {
+		return fmt.Errorf("mknod %s error %v", device.Path, err)
+	}
+	f, err := os.OpenFile(dest, os.O_CREATE, 0755)
+	if err != nil {
+		return err
+	}
+	f.Close()
+	source := device.HostPath
+	if source == "" {
+		source = device.Path
+	}
+	if err := syscall.Mount(source, dest, "bind", syscall.MS_BIND, ""); err != nil {
+		return fmt.Errorf("bind device %s error %v", device.Path, err)
+	}
+	return nil
+}
+
+func mountTmpfs(specs []string) error {
+	for _, spec := range specs {
+		dest, flags, data, err := ParseTmpfs(spec)
+		if err != nil {
+			return err
+		}
+		if err := os.MkdirAll(dest, 0755); err != nil {
+			return fmt.Errorf("mkdir tmpfs %s error %v", dest, err)
+		}
+		if err := syscall.Mount("tmpfs", dest, "tmpfs", flags, data); err != nil {
+			return fmt.Errorf("mount tmpfs %s error %v", dest, err)
+		}
+	}
+	return nil
+}
+
+func maskPaths(paths []string) error {
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if info.IsDir() {
+			err = syscall.Mount("tmpfs", path, "tmpfs", syscall.MS_RDONLY, "")
+		} else {
+			err = syscall.Mount("/dev/null", path, "bind", syscall.MS_BIND, "")
+		}
+		if err != nil {
+			return fmt.Errorf("mask %s error %v", path, err)
+		}
+	}
+	return nil
+}
+
+func readonlyPaths(paths []string) error {
+	for _, path := range paths {
+		if _, err := os.Stat(path); err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		if err := remountReadonly(path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// 先把路径 bind mount 到自身, 再重新挂载成只读
+func remountReadonly(path string) error {
+	if err := syscall.Mount(path, path, "bind", syscall.MS_BIND|syscall.MS_REC, ""); err != nil {
+		return fmt.Errorf("bind %s error %v", path, err)
+	}
+	return remountBind(path, syscall.MS_RDONLY)
+}
+
+// 重新挂载一个 bind mount, 保留原有的 nosuid/nodev/noexec 标志, 在 user namespace 中这些标志不允许清除
+func remountBind(path string, flags uintptr) error {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return fmt.Errorf("statfs %s error %v", path, err)
+	}
+	flags |= uintptr(stat.Flags) & (syscall.MS_NOSUID | syscall.MS_NODEV | syscall.MS_NOEXEC)
+	if err := syscall.Mount(path, path, "bind", syscall.MS_BIND|syscall.MS_REMOUNT|flags, ""); err != nil {
+		return fmt.Errorf("remount %s error %v", path, err)
+	}
+	return nil
+}
+
+func setNoNewPrivileges() error {
+	if _, _, errno := syscall.RawSyscall6(syscall.SYS_PRCTL, prSetNoNewPrivs, 1, 0, 0, 0, 0); errno != 0 {
+		return fmt.Errorf("prctl PR_SET_NO_NEW_PRIVS error %v", errno)
+	}
+	return nil
+}
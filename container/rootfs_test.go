@@ -0,0 +1,58 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+)
+
+func TestParseDevice(t *testing.T) {
+	device, err := ParseDevice("/dev/null:/dev/mynull:rw")
+	if err != nil {
+		t.Fatalf("parse device %v", err)
+	}
+	if device.Path != "/dev/mynull" || device.HostPath != "/dev/null" || device.Type != syscall.S_IFCHR ||
+		device.Major != 1 || device.Minor != 3 || device.Permissions != "rw" {
+		t.Errorf("parse device got %+v", *device)
+	}
+
+	device, err = ParseDevice("/dev/zero:r")
+	if err != nil || device.Path != "/dev/zero" || device.Permissions != "r" {
+		t.Errorf("parse device with permissions got %+v %v", device, err)
+	}
+
+	for _, spec := range []string{"/dev", "dev/null", "/dev/null:/dev/null:rx", "/dev/not-exist", "/dev/null:", "/dev/null:/dev/mynull:"} {
+		if _, err := ParseDevice(spec); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+}
+
+func TestCreateDeviceSymlink(t *testing.T) {
+	rootfs, err := ioutil.TempDir("", "rootfs")
+	if err != nil {
+		t.Fatalf("create temp dir %v", err)
+	}
+	defer os.RemoveAll(rootfs)
+	outside, err := ioutil.TempDir("", "outside")
+	if err != nil {
+		t.Fatalf("create temp dir %v", err)
+	}
+	defer os.RemoveAll(outside)
+	// 镜像中的 /dev 指向宿主机上的目录
+	if err := os.Symlink(outside, filepath.Join(rootfs, "dev")); err != nil {
+		t.Fatalf("symlink %v", err)
+	}
+	device := &Device{Path: "/dev/mynull", Type: syscall.S_IFCHR, Major: 1, Minor: 3, FileMode: 0666}
+	if err := createDevice(rootfs, device); err != nil {
+		t.Skipf("create device %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(outside, "mynull")); !os.IsNotExist(err) {
+		t.Errorf("device created outside of rootfs")
+	}
+	if _, err := os.Lstat(filepath.Join(rootfs, outside, "mynull")); err != nil {
+		t.Errorf("device not created in rootfs %v", err)
+	}
+}
@@ -0,0 +1,58 @@
+package container
+
+import (
+	"fmt"
+	"github.com/xianlubird/mydocker/seccomp"
+	"strconv"
+	"strings"
+)
+
+const (
+	SeccompDefault    = "default"
+	SeccompUnconfined = "unconfined"
+)
+
+// 解析 --security-opt 参数, 需要在确定容器的 capability 之后调用
+func ParseSecurityOpts(opts []string, containerInfo *ContainerInfo) error {
+	containerInfo.Seccomp = SeccompDefault
+	for _, opt := range opts {
+		kv := strings.SplitN(opt, "=", 2)
+		switch {
+		case kv[0] == "seccomp" && len(kv) == 2 && kv[1] != "":
+			profile, err := LoadSeccompProfile(kv[1])
+			if err != nil {
+				return err
+			}
+			if profile != nil {
+				if _, err := seccomp.Compile(profile, containerInfo.Capabilities); err != nil {
+					return fmt.Errorf("compile seccomp profile %s error %v", kv[1], err)
+				}
+			}
+			containerInfo.Seccomp = kv[1]
+		case kv[0] == "no-new-privileges":
+			enabled := true
+			if len(kv) == 2 {
+				value, err := strconv.ParseBool(kv[1])
+				if err != nil {
+					return fmt.Errorf("invalid value for no-new-privileges: %s", kv[1])
+				}
+				enabled = value
+			}
+			containerInfo.NoNewPrivileges = enabled
+		default:
+			return fmt.Errorf("unknown security option %s", opt)
+		}
+	}
+	return nil
+}
+
+// 根据 seccomp 参数加载配置, unconfined 时返回 nil
+func LoadSeccompProfile(name string) (*seccomp.Seccomp, error) {
+	switch name {
+	case "", SeccompDefault:
+		return seccomp.DefaultProfile(), nil
+	case SeccompUnconfined:
+		return nil, nil
+	}
+	return seccomp.LoadProfile(name)
+}
@@ -0,0 +1,66 @@
+package container
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// 只有这些 sysctl 是按 namespace 隔离的, 修改它们不会影响宿主机
+var namespacedSysctls = map[string]string{
+	"kernel.msgmax":          "ipc",
+	"kernel.msgmnb":          "ipc",
+	"kernel.msgmni":          "ipc",
+	"kernel.sem":             "ipc",
+	"kernel.shmall":          "ipc",
+	"kernel.shmmax":          "ipc",
+	"kernel.shmmni":          "ipc",
+	"kernel.shm_rmid_forced": "ipc",
+}
+
+var namespacedSysctlPrefixes = map[string]string{
+	"fs.mqueue.": "ipc",
+	"net.":       "net",
+}
+
+// 解析 --sysctl key=value 参数, 只允许设置容器自己新建的 network/ipc namespace 中的 sysctl
+func ParseSysctl(spec string, containerInfo *ContainerInfo) (string, string, error) {
+	kv := strings.SplitN(spec, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return "", "", fmt.Errorf("invalid sysctl %s, should be key=value", spec)
+	}
+	key := strings.Replace(kv[0], "/", ".", -1)
+	ns, ok := namespacedSysctls[key]
+	if !ok {
+		for prefix, prefixNs := range namespacedSysctlPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				ns, ok = prefixNs, true
+				break
+			}
+		}
+	}
+	if !ok {
+		return "", "", fmt.Errorf("sysctl %s is not namespaced and not allowed", key)
+	}
+	// 加入宿主机、其他容器或者 namespace 文件对应的 namespace 时, 写入的 sysctl 会影响它们, 只允许在新建的 namespace 中设置
+	mode := containerInfo.NetMode
+	if ns == "ipc" {
+		mode = containerInfo.IpcMode
+	}
+	if mode != "" {
+		return "", "", fmt.Errorf("sysctl %s is not allowed in %s namespace mode %s", key, ns, mode)
+	}
+	return key, kv[1], nil
+}
+
+// 在容器的 network/ipc namespace 中写入 sysctl, 需要在 /proc/sys 变成只读之前调用
+func writeSysctls(sysctls map[string]string) error {
+	for key, value := range sysctls {
+		path := filepath.Join("/proc/sys", strings.Replace(key, ".", "/", -1))
+		if err := ioutil.WriteFile(path, []byte(value), 0644); err != nil {
+			return fmt.Errorf("write sysctl %s error %v", key, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,39 @@
+package container
+
+import (
+	"testing"
+)
+
+func TestParseSysctl(t *testing.T) {
+	info := &ContainerInfo{}
+	key, value, err := ParseSysctl("net/core/somaxconn=1024", info)
+	if err != nil || key != "net.core.somaxconn" || value != "1024" {
+		t.Errorf("parse sysctl got %s=%s %v", key, value, err)
+	}
+	for _, spec := range []string{"kernel.shmmax=1", "fs.mqueue.msg_max=20", "net.ipv4.ip_local_port_range=1024 65000"} {
+		if _, _, err := ParseSysctl(spec, info); err != nil {
+			t.Errorf("parse %s %v", spec, err)
+		}
+	}
+	for _, spec := range []string{"kernel.pid_max=100", "vm.swappiness=1", "net.core.somaxconn"} {
+		if _, _, err := ParseSysctl(spec, info); err == nil {
+			t.Errorf("parse %s should fail", spec)
+		}
+	}
+	for _, mode := range []string{NamespaceModeHost, "container:test", "/var/run/netns/test"} {
+		sharedInfo := &ContainerInfo{NetMode: mode, IpcMode: mode}
+		for _, spec := range []string{"net.core.somaxconn=1024", "kernel.msgmax=1", "fs.mqueue.msg_max=20"} {
+			if _, _, err := ParseSysctl(spec, sharedInfo); err == nil {
+				t.Errorf("parse %s in namespace mode %s should fail", spec, mode)
+			}
+		}
+	}
+	// 只共享 network namespace 时仍然可以设置 ipc 的 sysctl
+	netInfo := &ContainerInfo{NetMode: "container:test"}
+	if _, _, err := ParseSysctl("kernel.msgmax=1", netInfo); err != nil {
+		t.Errorf("parse ipc sysctl with private ipc namespace %v", err)
+	}
+	if _, _, err := ParseSysctl("net.core.somaxconn=1024", netInfo); err == nil {
+		t.Errorf("parse net sysctl in container network namespace should fail")
+	}
+}
@@ -0,0 +1,216 @@
+package container
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"syscall"
+	"unsafe"
+)
+
+// 在容器内运行用户进程的身份
+type ExecUser struct {
+	Uid   int
+	Gid   int
+	Sgids []int //附加组
+	Home  string
+}
+
+type passwdEntry struct {
+	name string
+	uid  int
+	gid  int
+	home string
+}
+
+type groupEntry struct {
+	name    string
+	gid     int
+	members []string
+}
+
+// 解析 -u user[:group] 参数, 用户和组可以是名字或者数字 id, 名字通过容器内的 /etc/passwd 和 /etc/group 查找
+// 数字 id 不要求在 /etc/passwd 中存在, 和 docker 的行为一致
+func ResolveUser(spec, passwdPath, groupPath string) (*ExecUser, error) {
+	user := &ExecUser{Home: "/"}
+	if spec == "" {
+		spec = "0"
+	}
+	parts := strings.SplitN(spec, ":", 2)
+	userSpec, groupSpec := parts[0], ""
+	if len(parts) == 2 {
+		groupSpec = parts[1]
+	}
+
+	passwd, err := parsePasswd(passwdPath)
+	if err != nil {
+		return nil, err
+	}
+	var matched *passwdEntry
+	uid, uidErr := strconv.Atoi(userSpec)
+	for i := range passwd {
+		if (uidErr == nil && passwd[i].uid == uid) || (uidErr != nil && passwd[i].name == userSpec) {
+			matched = &passwd[i]
+			break
+		}
+	}
+	switch {
+	case matched != nil:
+		user.Uid, user.Gid, user.Home = matched.uid, matched.gid, matched.home
+	case uidErr == nil && uid >= 0:
+		user.Uid = uid
+	default:
+		return nil, fmt.Errorf("unable to find user %s: no matching entries in passwd file", userSpec)
+	}
+
+	groups, err := parseGroup(groupPath)
+	if err != nil {
+		return nil, err
+	}
+	if groupSpec != "" {
+		gid, gidErr := strconv.Atoi(groupSpec)
+		found := false
+		for _, g := range groups {
+			if (gidErr == nil && g.gid == gid) || (gidErr != nil && g.name == groupSpec) {
+				user.Gid, found = g.gid, true
+				break
+			}
+		}
+		if !found {
+			if gidErr != nil || gid < 0 {
+				return nil, fmt.Errorf("unable to find group %s: no matching entries in group file", groupSpec)
+			}
+			user.Gid = gid
+		}
+	}
+	if matched != nil {
+		for _, g := range groups {
+			for _, member := range g.members {
+				if member == matched.name && g.gid != user.Gid {
+					user.Sgids = append(user.Sgids, g.gid)
+					break
+				}
+			}
+		}
+	}
+	return user, nil
+}
+
+// exec 时在宿主机上通过 /proc/<pid>/root 读取容器内的 /etc/passwd 和 /etc/group
+// 路径在容器的根目录中解析, 容器内指向绝对路径的软链接不会读到宿主机上的文件
+func ResolveContainerUser(spec, rootPath string) (*ExecUser, error) {
+	passwdPath, err := securePath(rootPath, "/etc/passwd")
+	if err != nil {
+		return nil, err
+	}
+	groupPath, err := securePath(rootPath, "/etc/group")
+	if err != nil {
+		return nil, err
+	}
+	return ResolveUser(spec, passwdPath, groupPath)
+}
+
+// 文件不存在时返回空, 镜像中可以没有 /etc/passwd 和 /etc/group
+func readColonFile(path string, minFields int, fn func(fields []string)) error {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.Split(line, ":")
+		if len(fields) < minFields {
+			continue
+		}
+		fn(fields)
+	}
+	return scanner.Err()
+}
+
+func parsePasswd(path string) ([]passwdEntry, error) {
+	var entries []passwdEntry
+	err := readColonFile(path, 7, func(fields []string) {
+		uid, err1 := strconv.Atoi(fields[2])
+		gid, err2 := strconv.Atoi(fields[3])
+		if err1 != nil || err2 != nil {
+			return
+		}
+		entries = append(entries, passwdEntry{name: fields[0], uid: uid, gid: gid, home: fields[5]})
+	})
+	return entries, err
+}
+
+func parseGroup(path string) ([]groupEntry, error) {
+	var entries []groupEntry
+	err := readColonFile(path, 4, func(fields []string) {
+		gid, err := strconv.Atoi(fields[2])
+		if err != nil {
+			return
+		}
+		var members []string
+		for _, m := range strings.Split(fields[3], ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				members = append(members, m)
+			}
+		}
+		entries = append(entries, groupEntry{name: fields[0], gid: gid, members: members})
+	})
+	return entries, err
+}
+
+// 切换当前线程的身份, 设置 keepcaps 以便之后还能通过 capset 恢复 capability
+func setupUser(user *ExecUser) error {
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_KEEPCAPS, 1, 0); errno != 0 {
+		return fmt.Errorf("prctl PR_SET_KEEPCAPS error %v", errno)
+	}
+	gids := make([]uint32, len(user.Sgids))
+	for i, gid := range user.Sgids {
+		gids[i] = uint32(gid)
+	}
+	var gidsPtr uintptr
+	if len(gids) > 0 {
+		gidsPtr = uintptr(unsafe.Pointer(&gids[0]))
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETGROUPS, uintptr(len(gids)), gidsPtr, 0); errno != 0 {
+		return fmt.Errorf("setgroups error %v", errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETGID, uintptr(user.Gid), 0, 0); errno != 0 {
+		return fmt.Errorf("setgid %d error %v", user.Gid, errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_SETUID, uintptr(user.Uid), 0, 0); errno != 0 {
+		return fmt.Errorf("setuid %d error %v", user.Uid, errno)
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_KEEPCAPS, 0, 0); errno != 0 {
+		return fmt.Errorf("prctl PR_SET_KEEPCAPS error %v", errno)
+	}
+	return nil
+}
+
+// 创建并切换到工作目录, 新建的目录属于容器进程的用户
+func setupWorkingDir(dir string, user *ExecUser) error {
+	if dir == "" {
+		dir = "/"
+	}
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("mkdir workdir %s error %v", dir, err)
+		}
+		if err := os.Chown(dir, user.Uid, user.Gid); err != nil {
+			return fmt.Errorf("chown workdir %s error %v", dir, err)
+		}
+	}
+	if err := syscall.Chdir(dir); err != nil {
+		return fmt.Errorf("chdir %s error %v", dir, err)
+	}
+	return nil
+}
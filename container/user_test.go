@@ -0,0 +1,67 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestResolveUser(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mydocker-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	passwd, group := filepath.Join(dir, "passwd"), filepath.Join(dir, "group")
+	ioutil.WriteFile(passwd, []byte("root:x:0:0:root:/root:/bin/sh\napp:x:1000:1000::/home/app:/bin/sh\n"), 0644)
+	ioutil.WriteFile(group, []byte("root:x:0:\napp:x:1000:\nwheel:x:10:root,app\naudio:x:29:app\n"), 0644)
+
+	cases := []struct {
+		spec string
+		want ExecUser
+	}{
+		{"", ExecUser{Uid: 0, Gid: 0, Sgids: []int{10}, Home: "/root"}},
+		{"app", ExecUser{Uid: 1000, Gid: 1000, Sgids: []int{10, 29}, Home: "/home/app"}},
+		{"1000:wheel", ExecUser{Uid: 1000, Gid: 10, Sgids: []int{29}, Home: "/home/app"}},
+		{"2000:3000", ExecUser{Uid: 2000, Gid: 3000, Home: "/"}},
+	}
+	for _, c := range cases {
+		user, err := ResolveUser(c.spec, passwd, group)
+		if err != nil {
+			t.Fatalf("resolve %q %v", c.spec, err)
+		}
+		if !reflect.DeepEqual(*user, c.want) {
+			t.Errorf("resolve %q got %+v want %+v", c.spec, *user, c.want)
+		}
+	}
+
+	for _, spec := range []string{"nobody", "app:nogroup"} {
+		if _, err := ResolveUser(spec, passwd, group); err == nil {
+			t.Errorf("resolve %s should fail", spec)
+		}
+	}
+}
+
+func TestResolveContainerUser(t *testing.T) {
+	root, err := ioutil.TempDir("", "mydocker-user")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	os.MkdirAll(filepath.Join(root, "etc"), 0755)
+	os.MkdirAll(filepath.Join(root, "data"), 0755)
+	ioutil.WriteFile(filepath.Join(root, "data", "passwd"), []byte("app:x:1000:1000::/home/app:/bin/sh\n"), 0644)
+	// 指向绝对路径的软链接要在容器的根目录中解析, 不能读到宿主机上的文件
+	if err := os.Symlink("/data/passwd", filepath.Join(root, "etc", "passwd")); err != nil {
+		t.Fatal(err)
+	}
+	user, err := ResolveContainerUser("app", root)
+	if err != nil {
+		t.Fatalf("resolve app %v", err)
+	}
+	if user.Uid != 1000 || user.Gid != 1000 {
+		t.Errorf("resolve app got %+v", *user)
+	}
+}
@@ -0,0 +1,292 @@
+package container
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+var (
+	SubuidFile string = "/etc/subuid"
+	SubgidFile string = "/etc/subgid"
+)
+
+// IDMap 描述 user namespace 中容器内 ID 到宿主机 ID 的一段映射
+type IDMap struct {
+	ContainerID int `json:"containerId"`
+	HostID      int `json:"hostId"`
+	Size        int `json:"size"`
+}
+
+// 根据 --uidmap/--gidmap 参数生成映射, 没有指定时使用 /etc/subuid 和 /etc/subgid 中的从属ID段
+func NewUserNamespaceMappings(uidMapSpecs, gidMapSpecs []string) ([]IDMap, []IDMap, error) {
+	uidMaps, err := ParseIDMappings(uidMapSpecs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse uidmap error %v", err)
+	}
+	gidMaps, err := ParseIDMappings(gidMapSpecs)
+	if err != nil {
+		return nil, nil, fmt.Errorf("parse gidmap error %v", err)
+	}
+	if len(uidMaps) == 0 {
+		if uidMaps, err = SubordinateIDMappings(SubuidFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	if len(gidMaps) == 0 {
+		if gidMaps, err = SubordinateIDMappings(SubgidFile); err != nil {
+			return nil, nil, err
+		}
+	}
+	if _, ok := HostID(uidMaps, 0); !ok {
+		return nil, nil, fmt.Errorf("uidmap must map container root")
+	}
+	if _, ok := HostID(gidMaps, 0); !ok {
+		return nil, nil, fmt.Errorf("gidmap must map container root")
+	}
+	return uidMaps, gidMaps, nil
+}
+
+// 解析 containerID:hostID:size 格式的映射
+func ParseIDMappings(specs []string) ([]IDMap, error) {
+	var idMaps []IDMap
+	for _, spec := range specs {
+		parts := strings.Split(spec, ":")
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("id mapping %s should be containerID:hostID:size", spec)
+		}
+		var ids [3]int
+		for i, part := range parts {
+			id, err := strconv.Atoi(part)
+			if err != nil || id < 0 {
+				return nil, fmt.Errorf("invalid id %s in mapping %s", part, spec)
+			}
+			ids[i] = id
+		}
+		if ids[2] == 0 {
+			return nil, fmt.Errorf("id mapping %s has zero size", spec)
+		}
+		idMaps = append(idMaps, IDMap{ContainerID: ids[0], HostID: ids[1], Size: ids[2]})
+	}
+	return idMaps, nil
+}
+
+// 从 /etc/subuid 或 /etc/subgid 中找到当前用户的从属ID段, 映射为容器内从0开始的ID
+func SubordinateIDMappings(file string) ([]IDMap, error) {
+	current, err := user.Current()
+	if err != nil {
+		return nil, fmt.Errorf("get current user error %v", err)
+	}
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open %s error %v", file, err)
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Split(strings.TrimSpace(scanner.Text()), ":")
+		if len(fields) != 3 || (fields[0] != current.Username && fields[0] != current.Uid) {
+			continue
+		}
+		start, err := strconv.Atoi(fields[1])
+		if err != nil {
+			return nil, fmt.Errorf("invalid start %s in %s", fields[1], file)
+		}
+		count, err := strconv.Atoi(fields[2])
+		if err != nil || count == 0 {
+			return nil, fmt.Errorf("invalid count %s in %s", fields[2], file)
+		}
+		return []IDMap{{ContainerID: 0, HostID: start, Size: count}}, nil
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, fmt.Errorf("no subordinate id range for user %s in %s", current.Username, file)
+}
+
+// 容器内ID对应的宿主机ID
+func HostID(idMaps []IDMap, containerID int) (int, bool) {
+	for _, m := range idMaps {
+		if containerID >= m.ContainerID && containerID < m.ContainerID+m.Size {
+			return m.HostID + containerID - m.ContainerID, true
+		}
+	}
+	return -1, false
+}
+
+func toSysProcIDMap(idMaps []IDMap) []syscall.SysProcIDMap {
+	var sysMaps []syscall.SysProcIDMap
+	for _, m := range idMaps {
+		sysMaps = append(sysMaps, syscall.SysProcIDMap{ContainerID: m.ContainerID, HostID: m.HostID, Size: m.Size})
+	}
+	return sysMaps
+}
+
+// 把目录下所有文件的属主从容器内ID平移到宿主机ID, 映射外的ID保持不变
+func ShiftOwnership(root string, uidMaps, gidMaps []IDMap) error {
+	return filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		stat, ok := info.Sys().(*syscall.Stat_t)
+		if !ok {
+			return nil
+		}
+		uid, gid := int(stat.Uid), int(stat.Gid)
+		if hostUid, ok := HostID(uidMaps, uid); ok {
+			uid = hostUid
+		}
+		if hostGid, ok := HostID(gidMaps, gid); ok {
+			gid = hostGid
+		}
+		if err := os.Lchown(path, uid, gid); err != nil {
+			return err
+		}
+		// chown 会清掉 setuid/setgid 位, 需要恢复
+		if info.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 && info.Mode()&os.ModeSymlink == 0 {
+			return os.Chmod(path, info.Mode())
+		}
+		return nil
+	})
+}
+
+// 容器内的root需要能穿过宿主机上的工作目录才能进入rootfs
+// 通过 ACL 只给容器 root 对应的宿主机 uid 加上搜索权限, 不修改目录原来的权限, 比如宿主机的 /root
+func ensureSearchable(uid int, dirs ...string) error {
+	for _, dir := range dirs {
+		if err := grantSearch(dir, uid); err != nil {
+			return fmt.Errorf("grant search permission of %s to uid %d error %v", dir, uid, err)
+		}
+	}
+	return nil
+}
+
+// system.posix_acl_access 的二进制格式: 4 字节版本号, 之后每项是 2 字节 tag、2 字节权限和 4 字节 id
+const (
+	aclXattr     = "system.posix_acl_access"
+	aclVersion   = 2
+	aclUserObj   = 0x01
+	aclUser      = 0x02
+	aclGroupObj  = 0x04
+	aclGroup     = 0x08
+	aclMask      = 0x10
+	aclOther     = 0x20
+	aclExecute   = 0x01
+	aclUndefined = 0xffffffff
+)
+
+type aclEntry struct {
+	tag  uint16
+	perm uint16
+	id   uint32
+}
+
+func grantSearch(dir string, uid int) error {
+	info, err := os.Stat(dir)
+	if err != nil {
+		return err
+	}
+	if stat, ok := info.Sys().(*syscall.Stat_t); ok && int(stat.Uid) == uid {
+		return nil
+	}
+	if info.Mode().Perm()&0001 != 0 {
+		return nil
+	}
+	entries, err := readACL(dir, info.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	entries, err = addSearchACL(entries, uint32(uid))
+	if err != nil {
+		return err
+	}
+	return syscall.Setxattr(dir, aclXattr, encodeACL(entries), 0)
+}
+
+// 目录没有 ACL 时根据权限位生成最小的 ACL
+func readACL(dir string, mode os.FileMode) ([]aclEntry, error) {
+	buf := make([]byte, 1024)
+	n, err := syscall.Getxattr(dir, aclXattr, buf)
+	if err == syscall.ENODATA {
+		return []aclEntry{
+			{tag: aclUserObj, perm: uint16(mode>>6) & 7, id: aclUndefined},
+			{tag: aclGroupObj, perm: uint16(mode>>3) & 7, id: aclUndefined},
+			{tag: aclOther, perm: uint16(mode) & 7, id: aclUndefined},
+		}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return decodeACL(buf[:n])
+}
+
+// 加上 uid 的执行权限, 不能修改已有的 mask, 否则会扩大其他命名项的有效权限
+// 没有 mask 时以属组权限为基础加上执行权限, 属组的有效权限不变
+func addSearchACL(entries []aclEntry, uid uint32) ([]aclEntry, error) {
+	var result []aclEntry
+	foundUser, foundMask := false, false
+	var groupPerm uint16
+	for _, e := range entries {
+		switch {
+		case e.tag == aclUser && e.id == uid:
+			e.perm |= aclExecute
+			foundUser = true
+		case e.tag == aclMask:
+			if e.perm&aclExecute == 0 {
+				return nil, fmt.Errorf("acl mask does not allow search")
+			}
+			foundMask = true
+		case e.tag == aclGroupObj:
+			groupPerm = e.perm
+		}
+		result = append(result, e)
+	}
+	if !foundUser {
+		result = append(result, aclEntry{tag: aclUser, perm: aclExecute, id: uid})
+	}
+	if !foundMask {
+		result = append(result, aclEntry{tag: aclMask, perm: groupPerm | aclExecute, id: aclUndefined})
+	}
+	// 内核要求按 tag 和 id 排序
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].tag != result[j].tag {
+			return result[i].tag < result[j].tag
+		}
+		return result[i].id < result[j].id
+	})
+	return result, nil
+}
+
+func decodeACL(data []byte) ([]aclEntry, error) {
+	if len(data) < 4 || binary.LittleEndian.Uint32(data) != aclVersion || (len(data)-4)%8 != 0 {
+		return nil, fmt.Errorf("invalid acl")
+	}
+	var entries []aclEntry
+	for i := 4; i < len(data); i += 8 {
+		entries = append(entries, aclEntry{
+			tag:  binary.LittleEndian.Uint16(data[i:]),
+			perm: binary.LittleEndian.Uint16(data[i+2:]),
+			id:   binary.LittleEndian.Uint32(data[i+4:]),
+		})
+	}
+	return entries, nil
+}
+
+func encodeACL(entries []aclEntry) []byte {
+	data := make([]byte, 4+8*len(entries))
+	binary.LittleEndian.PutUint32(data, aclVersion)
+	for i, e := range entries {
+		binary.LittleEndian.PutUint16(data[4+8*i:], e.tag)
+		binary.LittleEndian.PutUint16(data[6+8*i:], e.perm)
+		binary.LittleEndian.PutUint32(data[8+8*i:], e.id)
+	}
+	return data
+}
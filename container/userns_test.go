@@ -0,0 +1,108 @@
+package container
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"syscall"
+	"testing"
+)
+
+func TestParseIDMappings(t *testing.T) {
+	idMaps, err := ParseIDMappings([]string{"0:100000:1000", "1000:1000:1"})
+	if err != nil {
+		t.Fatalf("parse id mappings %v", err)
+	}
+	if hostID, ok := HostID(idMaps, 0); !ok || hostID != 100000 {
+		t.Fatalf("container root mapped to %d", hostID)
+	}
+	if hostID, ok := HostID(idMaps, 1000); !ok || hostID != 1000 {
+		t.Fatalf("container 1000 mapped to %d", hostID)
+	}
+	if _, ok := HostID(idMaps, 1001); ok {
+		t.Fatalf("container 1001 should not be mapped")
+	}
+
+	for _, spec := range []string{"0:100000", "a:1:1", "0:1:0"} {
+		if _, err := ParseIDMappings([]string{spec}); err == nil {
+			t.Fatalf("parse %s should fail", spec)
+		}
+	}
+}
+
+func TestEnsureSearchable(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userns")
+	if err != nil {
+		t.Fatalf("create temp dir %v", err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.Chmod(dir, 0700); err != nil {
+		t.Fatalf("chmod %v", err)
+	}
+	if _, err := syscall.Getxattr(dir, aclXattr, make([]byte, 64)); err == syscall.EOPNOTSUPP {
+		t.Skip("acl not supported")
+	}
+	if err := ensureSearchable(100000, dir); err != nil {
+		t.Fatalf("ensure searchable %v", err)
+	}
+	info, err := os.Stat(dir)
+	if err != nil {
+		t.Fatalf("stat %v", err)
+	}
+	// other 的权限不能变
+	if info.Mode().Perm()&0007 != 0 {
+		t.Errorf("mode %v should not grant other any permission", info.Mode().Perm())
+	}
+	entries, err := readACL(dir, info.Mode().Perm())
+	if err != nil {
+		t.Fatalf("read acl %v", err)
+	}
+	want := []aclEntry{
+		{tag: aclUserObj, perm: 7, id: aclUndefined},
+		{tag: aclUser, perm: aclExecute, id: 100000},
+		{tag: aclGroupObj, perm: 0, id: aclUndefined},
+		{tag: aclMask, perm: aclExecute, id: aclUndefined},
+		{tag: aclOther, perm: 0, id: aclUndefined},
+	}
+	if !reflect.DeepEqual(entries, want) {
+		t.Errorf("acl %v, want %v", entries, want)
+	}
+	// 再执行一次不会重复添加
+	if err := ensureSearchable(100000, dir); err != nil {
+		t.Fatalf("ensure searchable again %v", err)
+	}
+	if again, _ := readACL(dir, info.Mode().Perm()); !reflect.DeepEqual(again, want) {
+		t.Errorf("acl after second call %v, want %v", again, want)
+	}
+}
+
+func TestAddSearchACL(t *testing.T) {
+	// 已有的 mask 包含执行权限时保持不变, 其他命名项的有效权限不会扩大
+	entries := []aclEntry{
+		{tag: aclUserObj, perm: 7, id: aclUndefined},
+		{tag: aclUser, perm: 7, id: 1000},
+		{tag: aclGroupObj, perm: 5, id: aclUndefined},
+		{tag: aclMask, perm: 5, id: aclUndefined},
+		{tag: aclOther, perm: 0, id: aclUndefined},
+	}
+	got, err := addSearchACL(entries, 100000)
+	if err != nil {
+		t.Fatalf("add search acl %v", err)
+	}
+	want := []aclEntry{
+		{tag: aclUserObj, perm: 7, id: aclUndefined},
+		{tag: aclUser, perm: 7, id: 1000},
+		{tag: aclUser, perm: aclExecute, id: 100000},
+		{tag: aclGroupObj, perm: 5, id: aclUndefined},
+		{tag: aclMask, perm: 5, id: aclUndefined},
+		{tag: aclOther, perm: 0, id: aclUndefined},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("acl %v, want %v", got, want)
+	}
+	// mask 不允许搜索时拒绝, 不能放宽 mask
+	entries[3].perm = 4
+	if _, err := addSearchACL(entries, 100000); err == nil {
+		t.Errorf("add search acl with restrictive mask should fail")
+	}
+}
@@ -4,30 +4,47 @@ import (
 	log "github.com/Sirupsen/logrus"
 	"os"
 	"os/exec"
-	"strings"
+	"path"
 	"fmt"
 )
 
 //Create a AUFS filesystem as container root workspace
-func NewWorkSpace(volume, imageName, containerName string) {
-	CreateReadOnlyLayer(imageName)
-	CreateWriteLayer(containerName)
-	CreateMountPoint(containerName, imageName)
-	if volume != "" {
-		volumeURLs := strings.Split(volume, ":")
-		length := len(volumeURLs)
-		if length == 2 && volumeURLs[0] != "" && volumeURLs[1] != "" {
-			MountVolume(volumeURLs, containerName)
-			log.Infof("NewWorkSpace volume urls %q", volumeURLs)
-		} else {
-			log.Infof("Volume parameter input is not correct.")
+func NewWorkSpace(containerInfo *ContainerInfo) error {
+	imageName, containerName := containerInfo.Image, containerInfo.Name
+	uidMaps, gidMaps := containerInfo.UidMappings, containerInfo.GidMappings
+	if err := CreateReadOnlyLayer(imageName, uidMaps, gidMaps); err != nil {
+		return fmt.Errorf("create read only layer error %v", err)
+	}
+	CreateWriteLayer(containerName, uidMaps, gidMaps)
+	if err := CreateMountPoint(containerName, ImageLayerUrl(imageName, uidMaps, gidMaps)); err != nil {
+		return fmt.Errorf("create mount point error %v", err)
+	}
+	if len(uidMaps) > 0 {
+		rootUid, _ := HostID(uidMaps, 0)
+		if err := ensureSearchable(rootUid, RootUrl, path.Dir(fmt.Sprintf(MntUrl, containerName))); err != nil {
+			return err
 		}
 	}
+	// 数据卷在 init 进程中挂载, 这里只准备宿主机上的目录
+	if err := prepareMountSources(containerInfo.Mounts, uidMaps, gidMaps); err != nil {
+		return fmt.Errorf("prepare mount sources error %v", err)
+	}
+	return nil
+}
+
+//Image layer location, user namespace containers get their own copy owned by the mapped ids
+func ImageLayerUrl(imageName string, uidMaps, gidMaps []IDMap) string {
+	if len(uidMaps) == 0 {
+		return RootUrl + "/" + imageName
+	}
+	rootUid, _ := HostID(uidMaps, 0)
+	rootGid, _ := HostID(gidMaps, 0)
+	return fmt.Sprintf("%s/%s-userns-%d-%d", RootUrl, imageName, rootUid, rootGid)
 }
 
 //Decompression tar image
-func CreateReadOnlyLayer(imageName string) error {
-	unTarFolderUrl := RootUrl + "/" + imageName + "/"
+func CreateReadOnlyLayer(imageName string, uidMaps, gidMaps []IDMap) error {
+	unTarFolderUrl := ImageLayerUrl(imageName, uidMaps, gidMaps) + "/"
 	imageUrl := RootUrl + "/" + imageName + ".tar"
 	exist, err := PathExists(unTarFolderUrl)
 	if err != nil {
@@ -35,56 +52,65 @@ func CreateReadOnlyLayer(imageName string) error {
 		return err
 	}
 	if !exist {
-		if err := os.MkdirAll(unTarFolderUrl, 0622); err != nil {
-			log.Errorf("Mkdir %s error %v", unTarFolderUrl, err)
+		// 先解压到临时目录, 完成之后再改名, 失败时不会留下解压或修改属主到一半的镜像层
+		layerUrl := path.Clean(unTarFolderUrl)
+		tmpUrl := path.Join(path.Dir(layerUrl), "."+path.Base(layerUrl)+".tmp")
+		if err := os.RemoveAll(tmpUrl); err != nil {
+			return err
+		}
+		if err := os.MkdirAll(tmpUrl, 0622); err != nil {
+			log.Errorf("Mkdir %s error %v", tmpUrl, err)
+			return err
+		}
+		if err := extractImage(imageUrl, tmpUrl, uidMaps, gidMaps); err != nil {
+			os.RemoveAll(tmpUrl)
 			return err
 		}
+		if err := os.Rename(tmpUrl, layerUrl); err != nil {
+			os.RemoveAll(tmpUrl)
+			return err
+		}
+	}
+	return nil
+}
 
-		if _, err := exec.Command("tar", "-xvf", imageUrl, "-C", unTarFolderUrl).CombinedOutput(); err != nil {
-			log.Errorf("Untar dir %s error %v", unTarFolderUrl, err)
+func extractImage(imageUrl, dir string, uidMaps, gidMaps []IDMap) error {
+	if _, err := exec.Command("tar", "-xvf", imageUrl, "-C", dir).CombinedOutput(); err != nil {
+		log.Errorf("Untar dir %s error %v", dir, err)
+		return err
+	}
+	if len(uidMaps) > 0 {
+		if err := ShiftOwnership(dir, uidMaps, gidMaps); err != nil {
+			log.Errorf("Shift ownership of %s error %v", dir, err)
 			return err
 		}
 	}
 	return nil
 }
 
-func CreateWriteLayer(containerName string) {
+func CreateWriteLayer(containerName string, uidMaps, gidMaps []IDMap) {
 	writeURL := fmt.Sprintf(WriteLayerUrl, containerName)
 	if err := os.MkdirAll(writeURL, 0777); err != nil {
 		log.Infof("Mkdir write layer dir %s error. %v", writeURL, err)
 	}
-}
-
-func MountVolume(volumeURLs []string, containerName string) error {
-	parentUrl := volumeURLs[0]
-	if err := os.Mkdir(parentUrl, 0777); err != nil {
-		log.Infof("Mkdir parent dir %s error. %v", parentUrl, err)
-	}
-	containerUrl := volumeURLs[1]
-	mntURL := fmt.Sprintf(MntUrl, containerName)
-	containerVolumeURL := mntURL + "/" +  containerUrl
-	if err := os.Mkdir(containerVolumeURL, 0777); err != nil {
-		log.Infof("Mkdir container dir %s error. %v", containerVolumeURL, err)
-	}
-	dirs := "dirs=" + parentUrl
-	_, err := exec.Command("mount", "-t", "aufs", "-o", dirs, "none", containerVolumeURL).CombinedOutput()
-	if err != nil {
-		log.Errorf("Mount volume failed. %v", err)
-		return err
+	if len(uidMaps) > 0 {
+		rootUid, _ := HostID(uidMaps, 0)
+		rootGid, _ := HostID(gidMaps, 0)
+		if err := os.Chown(writeURL, rootUid, rootGid); err != nil {
+			log.Errorf("Chown write layer dir %s error. %v", writeURL, err)
+		}
 	}
-	return nil
 }
 
-func CreateMountPoint(containerName , imageName string) error {
+func CreateMountPoint(containerName , imageLocation string) error {
 	mntUrl := fmt.Sprintf(MntUrl, containerName)
 	if err := os.MkdirAll(mntUrl, 0777); err != nil {
 		log.Errorf("Mkdir mountpoint dir %s error. %v", mntUrl, err)
 		return err
 	}
 	tmpWriteLayer := fmt.Sprintf(WriteLayerUrl, containerName)
-	tmpImageLocation := RootUrl + "/" + imageName
 	mntURL := fmt.Sprintf(MntUrl, containerName)
-	dirs := "dirs=" + tmpWriteLayer + ":" + tmpImageLocation
+	dirs := "dirs=" + tmpWriteLayer + ":" + imageLocation
 	_, err := exec.Command("mount", "-t", "aufs", "-o", dirs, "none", mntURL).CombinedOutput()
 	if err != nil {
 		log.Errorf("Run command for creating mount point failed %v", err)
@@ -94,14 +120,8 @@ func CreateMountPoint(containerName , imageName string) error {
 }
 
 //Delete the AUFS filesystem while container exit
-func DeleteWorkSpace(volume, containerName string) {
-	if volume != "" {
-		volumeURLs := strings.Split(volume, ":")
-		length := len(volumeURLs)
-		if length == 2 && volumeURLs[0] != "" && volumeURLs[1] != "" {
-			DeleteVolume(volumeURLs, containerName)
-		}
-	}
+//数据卷挂载在容器自己的 mount namespace 中, 容器退出时已经随之卸载
+func DeleteWorkSpace(containerName string) {
 	DeleteMountPoint(containerName)
 	DeleteWriteLayer(containerName)
 }
@@ -120,16 +140,6 @@ func DeleteMountPoint(containerName string) error {
 	return nil
 }
 
-func DeleteVolume(volumeURLs []string, containerName string) error {
-	mntURL := fmt.Sprintf(MntUrl, containerName)
-	containerUrl := mntURL + "/" +  volumeURLs[1]
-	if _, err := exec.Command("umount", containerUrl).CombinedOutput(); err != nil {
-		log.Errorf("Umount volume %s failed. %v", containerUrl, err)
-		return err
-	}
-	return nil
-}
-
 func DeleteWriteLayer(containerName string) {
 	writeURL := fmt.Sprintf(WriteLayerUrl, containerName)
 	if err := os.RemoveAll(writeURL); err != nil {
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/cgroups"
+	"github.com/xianlubird/mydocker/container"
+	"os"
+	"text/tabwriter"
+)
+
+// 打印容器的事件, 指定容器名时只打印这个容器的事件
+func listEvents(name string) error {
+	events, err := container.ReadEvents()
+	if err != nil {
+		return fmt.Errorf("Read events error %v", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "TIME\tID\tNAME\tACTION\n")
+	for _, event := range events {
+		if name != "" && event.Name != name && event.Id != name {
+			continue
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", event.Time, event.Id, event.Name, event.Action)
+	}
+	return w.Flush()
+}
+
+// 后台运行的容器没有进程监听 OOM 事件, 查看容器状态时根据 cgroup 中的 OOM kill 计数补充记录
+func refreshOOMKilled(containerInfo *container.ContainerInfo) {
+	if containerInfo.OOMKilled || containerInfo.CgroupPath == "" {
+		return
+	}
+	if cgroups.NewCgroupManager(containerInfo.CgroupPath).OOMKilled() {
+		markOOMKilled(containerInfo)
+	}
+}
+
+func markOOMKilled(containerInfo *container.ContainerInfo) {
+	containerInfo.OOMKilled = true
+	if err := saveContainerInfo(containerInfo); err != nil {
+		log.Warnf("Save container %s info error %v", containerInfo.Name, err)
+	}
+	container.RecordEvent(containerInfo, container.EventOOM)
+}
+
+// 前台运行的容器在 run 进程中监听 OOM 事件, cgroup 删除后停止监听
+func watchOOM(containerInfo *container.ContainerInfo) {
+	oom, err := cgroups.NewCgroupManager(containerInfo.CgroupPath).NotifyOOM()
+	if err != nil {
+		log.Warnf("Watch container %s oom error %v", containerInfo.Name, err)
+		return
+	}
+	name := containerInfo.Name
+	go func() {
+		for range oom {
+			// 容器信息由主 goroutine 维护, 这里重新读取一份
+			info, err := getContainerInfoByName(name)
+			if err != nil {
+				return
+			}
+			if !info.OOMKilled {
+				markOOMKilled(info)
+			}
+		}
+	}()
+}
@@ -9,19 +9,60 @@ import (
 	"strings"
 	"os/exec"
 	"os"
+	"strconv"
+	"syscall"
+	"github.com/xianlubird/mydocker/seccomp"
 	_ "github.com/xianlubird/mydocker/nsenter"
 )
 
 const ENV_EXEC_PID = "mydocker_pid"
 const ENV_EXEC_CMD = "mydocker_cmd"
+const ENV_EXEC_CAPS = "mydocker_caps"
+const ENV_EXEC_USER = "mydocker_user"
+const ENV_EXEC_CWD = "mydocker_cwd"
+const ENV_EXEC_SECCOMP = "mydocker_seccomp"
+const ENV_EXEC_NO_NEW_PRIVS = "mydocker_no_new_privs"
 
-func ExecContainer(containerName string, comArray []string) {
-	pid, err := GetContainerPidByName(containerName)
+func ExecContainer(containerName string, comArray []string, userSpec, workingDir string) {
+	containerInfo, err := getContainerInfoByName(containerName)
 	if err != nil {
-		log.Errorf("Exec container getContainerPidByName %s error %v", containerName, err)
+		log.Errorf("Exec container getContainerInfoByName %s error %v", containerName, err)
+		return
+	}
+	pid := containerInfo.Pid
+	capMask, err := container.CapabilityMask(containerInfo.Capabilities)
+	if err != nil {
+		log.Errorf("Exec container %s capabilities error %v", containerName, err)
+		return
+	}
+
+	if userSpec == "" {
+		userSpec = containerInfo.User
+	}
+	if workingDir == "" {
+		workingDir = containerInfo.WorkingDir
+	}
+	// 通过 /proc/<pid>/root 读取容器内的 /etc/passwd 和 /etc/group
+	user, err := container.ResolveContainerUser(userSpec, fmt.Sprintf("/proc/%s/root", pid))
+	if err != nil {
+		log.Errorf("Exec container %s resolve user %s error %v", containerName, userSpec, err)
 		return
 	}
 
+	// exec 进程和 init 进程使用同样的 seccomp 过滤器, 由 nsenter 在执行命令之前安装
+	profile, err := container.LoadSeccompProfile(containerInfo.Seccomp)
+	if err != nil {
+		log.Errorf("Exec container %s load seccomp profile error %v", containerName, err)
+		return
+	}
+	var filter []syscall.SockFilter
+	if profile != nil {
+		if filter, err = seccomp.Compile(profile, containerInfo.Capabilities); err != nil {
+			log.Errorf("Exec container %s compile seccomp profile error %v", containerName, err)
+			return
+		}
+	}
+
 	cmdStr := strings.Join(comArray, " ")
 	log.Infof("container pid %s", pid)
 	log.Infof("command %s", cmdStr)
@@ -33,6 +74,24 @@ func ExecContainer(containerName string, comArray []string) {
 
 	os.Setenv(ENV_EXEC_PID, pid)
 	os.Setenv(ENV_EXEC_CMD, cmdStr)
+	// 空集合表示容器没有任何 capability, exec 进程也要去掉全部 capability
+	if containerInfo.CapabilitiesSet {
+		os.Setenv(ENV_EXEC_CAPS, fmt.Sprintf("%#x", capMask))
+	}
+	var sgids []string
+	for _, gid := range user.Sgids {
+		sgids = append(sgids, strconv.Itoa(gid))
+	}
+	os.Setenv(ENV_EXEC_USER, fmt.Sprintf("%d:%d:%s", user.Uid, user.Gid, strings.Join(sgids, ",")))
+	if workingDir != "" {
+		os.Setenv(ENV_EXEC_CWD, workingDir)
+	}
+	if len(filter) > 0 {
+		os.Setenv(ENV_EXEC_SECCOMP, seccomp.EncodeFilter(filter))
+	}
+	if containerInfo.NoNewPrivileges {
+		os.Setenv(ENV_EXEC_NO_NEW_PRIVS, "1")
+	}
 	containerEnvs := getEnvsByPid(pid)
 	cmd.Env = append(os.Environ(), containerEnvs...)
 
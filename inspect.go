@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/cgroups/subsystems"
+	"github.com/xianlubird/mydocker/container"
+	"os"
+)
+
+// 运行中的容器额外输出 cgroup 的资源使用情况
+type containerInspect struct {
+	*container.ContainerInfo
+	Stats *subsystems.Stats `json:"stats,omitempty"`
+}
+
+func inspectContainer(containerName string) {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		log.Errorf("Get container %s info error %v", containerName, err)
+		return
+	}
+	refreshOOMKilled(containerInfo)
+	inspect := containerInspect{ContainerInfo: containerInfo}
+	if containerRunning(containerInfo) {
+		if inspect.Stats, err = containerStats(containerInfo); err != nil {
+			log.Warnf("Get container %s stats error %v", containerName, err)
+		}
+	}
+	content, err := json.MarshalIndent(inspect, "", "    ")
+	if err != nil {
+		log.Errorf("Json marshal %s error %v", containerName, err)
+		return
+	}
+	fmt.Fprintln(os.Stdout, string(content))
+}
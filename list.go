@@ -21,7 +21,7 @@ func ListContainers() {
 
 	var containers []*container.ContainerInfo
 	for _, file := range files {
-		if file.Name() == "network" {
+		if file.Name() == "network" || !file.IsDir() {
 			continue
 		}
 		tmpContainer, err := getContainerInfo(file)
@@ -29,17 +29,22 @@ func ListContainers() {
 			log.Errorf("Get container info error %v", err)
 			continue
 		}
+		refreshOOMKilled(tmpContainer)
 		containers = append(containers, tmpContainer)
 	}
 
 	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
 	fmt.Fprint(w, "ID\tNAME\tPID\tSTATUS\tCOMMAND\tCREATED\n")
 	for _, item := range containers {
+		status := item.Status
+		if item.OOMKilled {
+			status += " (OOMKilled)"
+		}
 		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\n",
 			item.Id,
 			item.Name,
 			item.Pid,
-			item.Status,
+			status,
 			item.Command,
 			item.CreatedTime)
 	}
@@ -20,11 +20,17 @@ func main() {
 		runCommand,
 		listCommand,
 		logCommand,
+		inspectCommand,
+		statsCommand,
+		eventsCommand,
 		execCommand,
+		updateCommand,
 		stopCommand,
 		removeCommand,
 		commitCommand,
 		networkCommand,
+		specCommand,
+		ociCommand,
 	}
 
 	app.Before = func(context *cli.Context) error {
@@ -4,10 +4,14 @@ import (
 	"fmt"
 	log "github.com/Sirupsen/logrus"
 	"github.com/urfave/cli"
+	"github.com/xianlubird/mydocker/cgroups"
 	"github.com/xianlubird/mydocker/cgroups/subsystems"
 	"github.com/xianlubird/mydocker/container"
 	"github.com/xianlubird/mydocker/network"
 	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
 )
 
 var runCommand = cli.Command{
@@ -24,23 +28,104 @@ var runCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "m",
-			Usage: "memory limit",
+			Usage: "memory limit ie: -m 512m",
+		},
+		cli.StringFlag{
+			Name:  "memory-swap",
+			Usage: "total limit of memory plus swap, -1 for unlimited swap ie: --memory-swap 1g",
+		},
+		cli.StringFlag{
+			Name:  "memory-reservation",
+			Usage: "memory soft limit ie: --memory-reservation 200m",
+		},
+		cli.Int64Flag{
+			Name:  "memory-swappiness",
+			Usage: "tune container memory swappiness (0 to 100)",
+			Value: -1,
 		},
 		cli.StringFlag{
+			Name:  "kernel-memory",
+			Usage: "kernel memory limit",
+		},
+		cli.BoolFlag{
+			Name:  "oom-kill-disable",
+			Usage: "disable OOM killer",
+		},
+		cli.Uint64Flag{
 			Name:  "cpushare",
 			Usage: "cpushare limit",
 		},
 		cli.StringFlag{
 			Name:  "cpuset",
-			Usage: "cpuset limit",
+			Usage: "cpus in which to allow execution ie: 0-3,5",
+		},
+		cli.StringFlag{
+			Name:  "cpuset-mems",
+			Usage: "memory nodes in which to allow execution ie: 0,1",
+		},
+		cli.Float64Flag{
+			Name:  "cpus",
+			Usage: "number of CPUs ie: 1.5",
+		},
+		cli.Uint64Flag{
+			Name:  "cpu-period",
+			Usage: "limit CPU CFS (Completely Fair Scheduler) period in microseconds",
+		},
+		cli.Int64Flag{
+			Name:  "cpu-quota",
+			Usage: "limit CPU CFS (Completely Fair Scheduler) quota in microseconds",
+		},
+		cli.Uint64Flag{
+			Name:  "cpu-rt-period",
+			Usage: "limit CPU real-time period in microseconds",
+		},
+		cli.Int64Flag{
+			Name:  "cpu-rt-runtime",
+			Usage: "limit CPU real-time runtime in microseconds",
+		},
+		cli.Int64Flag{
+			Name:  "pids-limit",
+			Usage: "tune container pids limit (set -1 for unlimited)",
+		},
+		cli.IntFlag{
+			Name:  "blkio-weight",
+			Usage: "block IO weight (relative weight), between 10 and 1000, or 0 to disable",
+		},
+		cli.StringSliceFlag{
+			Name:  "blkio-weight-device",
+			Usage: "block IO weight (relative device weight) ie: /dev/sda:200",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-read-bps",
+			Usage: "limit read rate (bytes per second) from a device ie: /dev/sda:1mb",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-write-bps",
+			Usage: "limit write rate (bytes per second) to a device ie: /dev/sda:1mb",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-read-iops",
+			Usage: "limit read rate (IO per second) from a device ie: /dev/sda:1000",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-write-iops",
+			Usage: "limit write rate (IO per second) to a device ie: /dev/sda:1000",
+		},
+		cli.StringSliceFlag{
+			Name:  "hugetlb-limit",
+			Usage: "limit hugepage usage ie: --hugetlb-limit 2MB:512MB",
 		},
 		cli.StringFlag{
 			Name:  "name",
 			Usage: "container name",
 		},
-		cli.StringFlag{
+		cli.StringSliceFlag{
 			Name:  "v",
-			Usage: "volume",
+			Usage: "bind mount a volume ie: /host:/container[:ro]",
+		},
+		cli.StringSliceFlag{
+			Name:  "mount",
+			Usage: "attach a filesystem mount ie: type=bind,src=/host,dst=/container,readonly",
 		},
 		cli.StringSliceFlag{
 			Name:  "e",
@@ -48,12 +133,131 @@ var runCommand = cli.Command{
 		},
 		cli.StringFlag{
 			Name:  "net",
-			Usage: "container network",
+			Usage: "container network, or host, container:<name>, a namespace path to share a network namespace",
+		},
+		cli.StringFlag{
+			Name:  "pid",
+			Usage: "pid namespace to use ie: host, container:<name>",
+		},
+		cli.StringFlag{
+			Name:  "ipc",
+			Usage: "ipc namespace to use ie: host, container:<name>",
+		},
+		cli.StringFlag{
+			Name:  "uts",
+			Usage: "uts namespace to use ie: host, container:<name>",
+		},
+		cli.StringFlag{
+			Name:  "cgroup-parent",
+			Value: cgroups.DefaultCgroupParent,
+			Usage: "parent cgroup for the container ie: /mydocker/web",
+		},
+		cli.StringFlag{
+			Name:  "cgroupns",
+			Value: container.NamespaceModePrivate,
+			Usage: "cgroup namespace to use ie: private, host",
+		},
+		cli.StringSliceFlag{
+			Name:  "device",
+			Usage: "add a host device to the container ie: /dev/fuse[:/dev/fuse][:rwm]",
+		},
+		cli.StringSliceFlag{
+			Name:  "device-cgroup-rule",
+			Usage: "add a rule to the cgroup allowed devices list ie: 'c 10:200 rwm'",
+		},
+		cli.StringSliceFlag{
+			Name:  "sysctl",
+			Usage: "namespaced kernel parameters ie: net.core.somaxconn=1024",
+		},
+		cli.StringFlag{
+			Name:  "time-offset",
+			Usage: "run in a new time namespace with clock offsets ie: monotonic=1h,boottime=86400",
 		},
 		cli.StringSliceFlag{
 			Name: "p",
 			Usage: "port mapping",
 		},
+		cli.BoolFlag{
+			Name:  "userns",
+			Usage: "run container in a new user namespace",
+		},
+		cli.StringSliceFlag{
+			Name:  "uidmap",
+			Usage: "user namespace uid mapping containerID:hostID:size",
+		},
+		cli.StringSliceFlag{
+			Name:  "gidmap",
+			Usage: "user namespace gid mapping containerID:hostID:size",
+		},
+		cli.StringSliceFlag{
+			Name:  "cap-add",
+			Usage: "add linux capabilities",
+		},
+		cli.StringSliceFlag{
+			Name:  "cap-drop",
+			Usage: "drop linux capabilities",
+		},
+		cli.BoolFlag{
+			Name:  "privileged",
+			Usage: "give all capabilities to the container",
+		},
+		cli.StringSliceFlag{
+			Name:  "security-opt",
+			Usage: "security options ie: seccomp=<profile file|unconfined>, no-new-privileges",
+		},
+		cli.BoolFlag{
+			Name:  "read-only",
+			Usage: "mount the container's root filesystem as read only",
+		},
+		cli.StringSliceFlag{
+			Name:  "tmpfs",
+			Usage: "mount a writable tmpfs ie: /run:size=64m",
+		},
+		cli.StringFlag{
+			Name:  "shm-size",
+			Value: container.DefaultShmSize,
+			Usage: "size of /dev/shm ie: 64m",
+		},
+		cli.StringFlag{
+			Name:  "hostname",
+			Usage: "container host name",
+		},
+		cli.StringSliceFlag{
+			Name:  "dns",
+			Usage: "set custom dns servers",
+		},
+		cli.StringSliceFlag{
+			Name:  "dns-search",
+			Usage: "set custom dns search domains",
+		},
+		cli.StringSliceFlag{
+			Name:  "dns-option",
+			Usage: "set dns options",
+		},
+		cli.StringSliceFlag{
+			Name:  "add-host",
+			Usage: "add a custom host-to-IP mapping ie: host:ip",
+		},
+		cli.StringFlag{
+			Name:  "u",
+			Usage: "username or uid ie: user[:group]",
+		},
+		cli.StringFlag{
+			Name:  "w",
+			Usage: "working directory inside the container",
+		},
+		cli.StringSliceFlag{
+			Name:  "ulimit",
+			Usage: "ulimit options ie: nofile=1024:2048",
+		},
+		cli.IntFlag{
+			Name:  "oom-score-adj",
+			Usage: "tune container's OOM preferences (-1000 to 1000)",
+		},
+		cli.StringFlag{
+			Name:  "hooks",
+			Usage: "path to a hooks json file ie: {\"prestart\":[{\"path\":\"/usr/local/bin/register\",\"timeout\":5}]}",
+		},
 	},
 	Action: func(context *cli.Context) error {
 		if len(context.Args()) < 1 {
@@ -75,20 +279,302 @@ var runCommand = cli.Command{
 			return fmt.Errorf("ti and d paramter can not both provided")
 		}
 		resConf := &subsystems.ResourceConfig{
-			MemoryLimit: context.String("m"),
-			CpuSet:      context.String("cpuset"),
-			CpuShare:    context.String("cpushare"),
+			CpuShare: context.Uint64("cpushare"),
+		}
+		// 内存大小支持 k/m/g 后缀, --memory-swap 为 -1 时不限制 swap
+		if swap := context.String("memory-swap"); swap == "-1" {
+			resConf.MemorySwap = -1
+		} else if swap != "" {
+			bytes, err := subsystems.ParseBytes(swap)
+			if err != nil {
+				return fmt.Errorf("invalid memory swap %s", swap)
+			}
+			resConf.MemorySwap = int64(bytes)
+		}
+		for flag, value := range map[string]*int64{
+			"m":                  &resConf.MemoryLimit,
+			"memory-reservation": &resConf.MemoryReservation,
+			"kernel-memory":      &resConf.KernelMemory,
+		} {
+			if spec := context.String(flag); spec != "" {
+				bytes, err := subsystems.ParseBytes(spec)
+				if err != nil {
+					return fmt.Errorf("invalid size %s for -%s", spec, flag)
+				}
+				*value = int64(bytes)
+			}
+		}
+		for flag, list := range map[string]*subsystems.CPUList{
+			"cpuset":      &resConf.CpuSet,
+			"cpuset-mems": &resConf.CpusetMems,
+		} {
+			if spec := context.String(flag); spec != "" {
+				var err error
+				if *list, err = subsystems.ParseCPUList(spec); err != nil {
+					return err
+				}
+			}
+		}
+		if swappiness := context.Int64("memory-swappiness"); swappiness != -1 {
+			resConf.MemorySwappiness = &swappiness
+		}
+		resConf.OomKillDisable = context.Bool("oom-kill-disable")
+		resConf.CpuPeriod = context.Uint64("cpu-period")
+		resConf.CpuQuota = context.Int64("cpu-quota")
+		if cpus := context.Float64("cpus"); cpus != 0 {
+			if resConf.CpuPeriod != 0 || resConf.CpuQuota != 0 {
+				return fmt.Errorf("cpus can not be used with cpu-period or cpu-quota")
+			}
+			quota, err := subsystems.CpusToQuota(cpus)
+			if err != nil {
+				return err
+			}
+			resConf.CpuPeriod, resConf.CpuQuota = subsystems.DefaultCpuPeriod, quota
+		}
+		resConf.CpuRtPeriod = context.Uint64("cpu-rt-period")
+		resConf.CpuRtRuntime = context.Int64("cpu-rt-runtime")
+		// 0 表示使用默认值, 负数表示不限制
+		if resConf.PidsLimit = context.Int64("pids-limit"); resConf.PidsLimit < 0 {
+			resConf.PidsLimit = -1
+		}
+		if err := subsystems.ValidateBlkioWeight(context.Int("blkio-weight")); err != nil {
+			return err
+		}
+		resConf.BlkioWeight = uint16(context.Int("blkio-weight"))
+		for _, spec := range context.StringSlice("blkio-weight-device") {
+			device, err := subsystems.ParseWeightDevice(spec)
+			if err != nil {
+				return err
+			}
+			resConf.BlkioWeightDevice = append(resConf.BlkioWeightDevice, *device)
+		}
+		// 设备路径在这里解析成设备号, bps 支持 k/m/g 后缀
+		for flag, devices := range map[string]*[]subsystems.ThrottleDevice{
+			"device-read-bps":   &resConf.BlkioDeviceReadBps,
+			"device-write-bps":  &resConf.BlkioDeviceWriteBps,
+			"device-read-iops":  &resConf.BlkioDeviceReadIOps,
+			"device-write-iops": &resConf.BlkioDeviceWriteIOps,
+		} {
+			for _, spec := range context.StringSlice(flag) {
+				device, err := subsystems.ParseThrottleDevice(spec, strings.HasSuffix(flag, "bps"))
+				if err != nil {
+					return err
+				}
+				*devices = append(*devices, *device)
+			}
+		}
+		for _, spec := range context.StringSlice("hugetlb-limit") {
+			hugepage, err := subsystems.ParseHugetlbLimit(spec)
+			if err != nil {
+				return err
+			}
+			resConf.HugetlbLimit = append(resConf.HugetlbLimit, *hugepage)
+		}
+		if err := resConf.Validate(); err != nil {
+			return err
 		}
 		log.Infof("createTty %v", createTty)
-		containerName := context.String("name")
-		volume := context.String("v")
+		containerInfo := &container.ContainerInfo{
+			Name:        context.String("name"),
+			Image:       imageName,
+			PortMapping: context.StringSlice("p"),
+		}
 		network := context.String("net")
+		if network == container.NamespaceModeHost || container.NamespaceContainer(network) != "" || filepath.IsAbs(network) {
+			if len(containerInfo.PortMapping) > 0 {
+				return fmt.Errorf("port mapping can not be used with network mode %s", network)
+			}
+			containerInfo.NetMode = network
+			network = ""
+		}
+		containerInfo.PidMode = context.String("pid")
+		containerInfo.IpcMode = context.String("ipc")
+		containerInfo.UtsMode = context.String("uts")
+		for _, mode := range []string{containerInfo.PidMode, containerInfo.IpcMode, containerInfo.UtsMode} {
+			if err := container.ValidateNamespaceMode(mode); err != nil {
+				return err
+			}
+		}
+		containerInfo.CgroupParent = context.String("cgroup-parent")
+		if err := cgroups.ValidateCgroupParent(containerInfo.CgroupParent); err != nil {
+			return err
+		}
+		containerInfo.CgroupnsMode = context.String("cgroupns")
+		if containerInfo.CgroupnsMode != container.NamespaceModePrivate && containerInfo.CgroupnsMode != container.NamespaceModeHost {
+			return fmt.Errorf("invalid cgroupns mode %s, should be private or host", containerInfo.CgroupnsMode)
+		}
+		if spec := context.String("time-offset"); spec != "" {
+			offsets, err := container.ParseTimeOffsets(spec)
+			if err != nil {
+				return err
+			}
+			containerInfo.TimeOffsets = offsets
+		}
+		for _, spec := range context.StringSlice("sysctl") {
+			key, value, err := container.ParseSysctl(spec, containerInfo)
+			if err != nil {
+				return err
+			}
+			if containerInfo.Sysctls == nil {
+				containerInfo.Sysctls = map[string]string{}
+			}
+			containerInfo.Sysctls[key] = value
+		}
+
+		// devices cgroup 默认拒绝所有设备, 只放行默认设备和 --device/--device-cgroup-rule 指定的设备
+		deviceRules := append([]subsystems.DeviceRule{}, subsystems.DefaultDeviceRules...)
+		if context.Bool("privileged") {
+			deviceRules = []subsystems.DeviceRule{subsystems.AllowAllDeviceRule}
+		}
+		for _, spec := range context.StringSlice("device") {
+			device, err := container.ParseDevice(spec)
+			if err != nil {
+				return err
+			}
+			containerInfo.Devices = append(containerInfo.Devices, *device)
+			devType := "c"
+			if device.Type == syscall.S_IFBLK {
+				devType = "b"
+			}
+			deviceRules = append(deviceRules, subsystems.DeviceRule{
+				Type:   devType,
+				Major:  int64(device.Major),
+				Minor:  int64(device.Minor),
+				Access: device.Permissions,
+			})
+		}
+		for _, spec := range context.StringSlice("device-cgroup-rule") {
+			rule, err := subsystems.ParseDeviceRule(spec)
+			if err != nil {
+				return err
+			}
+			deviceRules = append(deviceRules, *rule)
+		}
+		containerInfo.DeviceCgroupRules = context.StringSlice("device-cgroup-rule")
+		resConf.DeviceRules = deviceRules
+
+		for _, spec := range context.StringSlice("v") {
+			m, err := container.ParseVolume(spec)
+			if err != nil {
+				return err
+			}
+			containerInfo.Mounts = append(containerInfo.Mounts, *m)
+		}
+		for _, spec := range context.StringSlice("mount") {
+			m, err := container.ParseMount(spec)
+			if err != nil {
+				return err
+			}
+			containerInfo.Mounts = append(containerInfo.Mounts, *m)
+		}
 
 		envSlice := context.StringSlice("e")
-		portmapping := context.StringSlice("p")
 
-		Run(createTty, cmdArray, resConf, containerName, volume, imageName, envSlice, network, portmapping)
-		return nil
+		uidMapSpecs, gidMapSpecs := context.StringSlice("uidmap"), context.StringSlice("gidmap")
+		if context.Bool("userns") || len(uidMapSpecs) > 0 || len(gidMapSpecs) > 0 {
+			uidMaps, gidMaps, err := container.NewUserNamespaceMappings(uidMapSpecs, gidMapSpecs)
+			if err != nil {
+				return err
+			}
+			containerInfo.UidMappings = uidMaps
+			containerInfo.GidMappings = gidMaps
+		}
+
+		caps, err := container.TweakCapabilities(context.StringSlice("cap-add"), context.StringSlice("cap-drop"), context.Bool("privileged"))
+		if err != nil {
+			return err
+		}
+		containerInfo.Capabilities = caps
+
+		if err := container.ParseSecurityOpts(context.StringSlice("security-opt"), containerInfo); err != nil {
+			return err
+		}
+		if !context.Bool("privileged") {
+			containerInfo.MaskedPaths = container.DefaultMaskedPaths
+			containerInfo.ReadonlyPaths = container.DefaultReadonlyPaths
+		}
+
+		containerInfo.ReadonlyRootfs = context.Bool("read-only")
+		for _, spec := range context.StringSlice("tmpfs") {
+			if _, _, _, err := container.ParseTmpfs(spec); err != nil {
+				return err
+			}
+		}
+		containerInfo.Tmpfs = context.StringSlice("tmpfs")
+
+		if err := container.ValidateShmSize(context.String("shm-size")); err != nil {
+			return err
+		}
+		containerInfo.ShmSize = context.String("shm-size")
+
+		if hostname := context.String("hostname"); hostname != "" {
+			if err := container.ValidateHostname(hostname); err != nil {
+				return err
+			}
+			if containerInfo.UtsMode != "" {
+				return fmt.Errorf("hostname can not be used with uts mode %s", containerInfo.UtsMode)
+			}
+			containerInfo.Hostname = hostname
+		}
+		for _, dns := range context.StringSlice("dns") {
+			if err := container.ValidateDns(dns); err != nil {
+				return err
+			}
+		}
+		containerInfo.Dns = context.StringSlice("dns")
+		containerInfo.DnsSearch = context.StringSlice("dns-search")
+		containerInfo.DnsOptions = context.StringSlice("dns-option")
+		for _, spec := range context.StringSlice("add-host") {
+			if _, _, err := container.ParseExtraHost(spec); err != nil {
+				return err
+			}
+		}
+		containerInfo.ExtraHosts = context.StringSlice("add-host")
+
+		// 没有指定 -u/-w 时使用镜像元数据中的默认值
+		imageConfig, err := container.LoadImageConfig(imageName)
+		if err != nil {
+			return err
+		}
+		containerInfo.User = context.String("u")
+		if containerInfo.User == "" {
+			containerInfo.User = imageConfig.User
+		}
+		containerInfo.WorkingDir = context.String("w")
+		if containerInfo.WorkingDir == "" {
+			containerInfo.WorkingDir = imageConfig.WorkingDir
+		}
+		if containerInfo.WorkingDir != "" && !filepath.IsAbs(containerInfo.WorkingDir) {
+			return fmt.Errorf("working directory %s must be absolute", containerInfo.WorkingDir)
+		}
+
+		for _, spec := range context.StringSlice("ulimit") {
+			ulimit, err := container.ParseUlimit(spec)
+			if err != nil {
+				return err
+			}
+			containerInfo.Ulimits = append(containerInfo.Ulimits, *ulimit)
+		}
+		if err := container.ValidateOomScoreAdj(context.Int("oom-score-adj")); err != nil {
+			return err
+		}
+		containerInfo.OomScoreAdj = context.Int("oom-score-adj")
+
+		// 全局 hook 在 --hooks 指定的 hook 之前执行
+		hooks, err := container.LoadGlobalHooks()
+		if err != nil {
+			return err
+		}
+		if path := context.String("hooks"); path != "" {
+			containerHooks, err := container.LoadHooks(path)
+			if err != nil {
+				return err
+			}
+			hooks.Append(containerHooks)
+		}
+		containerInfo.Hooks = *hooks
+
+		return Run(createTty, cmdArray, resConf, containerInfo, envSlice, network)
 	},
 }
 
@@ -124,9 +610,48 @@ var logCommand = cli.Command{
 	},
 }
 
+var inspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "show the configuration and state of a container",
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		containerName := context.Args().Get(0)
+		inspectContainer(containerName)
+		return nil
+	},
+}
+
+var statsCommand = cli.Command{
+	Name:  "stats",
+	Usage: "display resource usage statistics of containers ie: mydocker stats [container...]",
+	Action: func(context *cli.Context) error {
+		return statsContainers(context.Args())
+	},
+}
+
+var eventsCommand = cli.Command{
+	Name:  "events",
+	Usage: "show container events ie: mydocker events [container]",
+	Action: func(context *cli.Context) error {
+		return listEvents(context.Args().Get(0))
+	},
+}
+
 var execCommand = cli.Command{
 	Name:  "exec",
 	Usage: "exec a command into container",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "u",
+			Usage: "username or uid ie: user[:group], default to the container's user",
+		},
+		cli.StringFlag{
+			Name:  "w",
+			Usage: "working directory inside the container, default to the container's working directory",
+		},
+	},
 	Action: func(context *cli.Context) error {
 		//This is for callback
 		if os.Getenv(ENV_EXEC_PID) != "" {
@@ -142,11 +667,90 @@ var execCommand = cli.Command{
 		for _, arg := range context.Args().Tail() {
 			commandArray = append(commandArray, arg)
 		}
-		ExecContainer(containerName, commandArray)
+		ExecContainer(containerName, commandArray, context.String("u"), context.String("w"))
 		return nil
 	},
 }
 
+var updateCommand = cli.Command{
+	Name:  "update",
+	Usage: "update resource limits of a running container ie: mydocker update -m 200m [container]",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "memory, m",
+			Usage: "memory limit",
+		},
+		cli.Uint64Flag{
+			Name:  "cpushare",
+			Usage: "cpushare limit",
+		},
+		cli.StringFlag{
+			Name:  "cpuset",
+			Usage: "cpus in which to allow execution ie: 0-3,5",
+		},
+		cli.StringFlag{
+			Name:  "cpuset-mems",
+			Usage: "memory nodes in which to allow execution ie: 0,1",
+		},
+		cli.Float64Flag{
+			Name:  "cpus",
+			Usage: "number of CPUs ie: 1.5",
+		},
+		cli.Int64Flag{
+			Name:  "pids-limit",
+			Usage: "tune container pids limit (set -1 for unlimited)",
+		},
+		cli.IntFlag{
+			Name:  "blkio-weight",
+			Usage: "block IO weight (relative weight), between 10 and 1000",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		if len(context.Args()) < 1 {
+			return fmt.Errorf("Missing container name")
+		}
+		if context.NumFlags() == 0 {
+			return fmt.Errorf("You must provide one or more flags when using this command")
+		}
+		update := &subsystems.ResourceConfig{
+			CpuShare: context.Uint64("cpushare"),
+		}
+		if spec := context.String("memory"); spec != "" {
+			bytes, err := subsystems.ParseBytes(spec)
+			if err != nil {
+				return fmt.Errorf("invalid size %s for --memory", spec)
+			}
+			update.MemoryLimit = int64(bytes)
+		}
+		for flag, list := range map[string]*subsystems.CPUList{
+			"cpuset":      &update.CpuSet,
+			"cpuset-mems": &update.CpusetMems,
+		} {
+			if spec := context.String(flag); spec != "" {
+				var err error
+				if *list, err = subsystems.ParseCPUList(spec); err != nil {
+					return err
+				}
+			}
+		}
+		if cpus := context.Float64("cpus"); cpus != 0 {
+			quota, err := subsystems.CpusToQuota(cpus)
+			if err != nil {
+				return err
+			}
+			update.CpuPeriod, update.CpuQuota = subsystems.DefaultCpuPeriod, quota
+		}
+		if update.PidsLimit = context.Int64("pids-limit"); update.PidsLimit < 0 {
+			update.PidsLimit = -1
+		}
+		if err := subsystems.ValidateBlkioWeight(context.Int("blkio-weight")); err != nil {
+			return err
+		}
+		update.BlkioWeight = uint16(context.Int("blkio-weight"))
+		return updateContainer(context.Args().Get(0), update)
+	},
+}
+
 var stopCommand = cli.Command{
 	Name:  "stop",
 	Usage: "stop a container",
@@ -242,3 +846,92 @@ var networkCommand = cli.Command{
 		},
 	},
 }
+
+var specCommand = cli.Command{
+	Name:  "spec",
+	Usage: "create a default OCI config.json in the bundle directory",
+	Flags: []cli.Flag{
+		cli.StringFlag{
+			Name:  "bundle, b",
+			Value: ".",
+			Usage: "path to the bundle directory",
+		},
+	},
+	Action: func(context *cli.Context) error {
+		return generateSpec(context.String("bundle"))
+	},
+}
+
+var ociCommand = cli.Command{
+	Name:  "oci",
+	Usage: "OCI runtime commands, ie: mydocker oci create --bundle . [id]",
+	Subcommands: []cli.Command{
+		{
+			Name:  "create",
+			Usage: "create a container from an OCI bundle, the user process waits for start",
+			Flags: []cli.Flag{
+				cli.StringFlag{
+					Name:  "bundle, b",
+					Value: ".",
+					Usage: "path to the bundle directory",
+				},
+			},
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("Missing container id")
+				}
+				return createOCIContainer(context.Args().Get(0), context.String("bundle"))
+			},
+		},
+		{
+			Name:  "start",
+			Usage: "run the user process of a created container",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("Missing container id")
+				}
+				return startOCIContainer(context.Args().Get(0))
+			},
+		},
+		{
+			Name:  "state",
+			Usage: "output the state of a container",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("Missing container id")
+				}
+				return printOCIState(context.Args().Get(0))
+			},
+		},
+		{
+			Name:  "kill",
+			Usage: "send a signal to the init process, ie: mydocker oci kill [id] [signal]",
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("Missing container id")
+				}
+				signal := "SIGTERM"
+				if len(context.Args()) > 1 {
+					signal = context.Args().Get(1)
+				}
+				return killOCIContainer(context.Args().Get(0), signal)
+			},
+		},
+		{
+			Name:  "delete",
+			Usage: "delete a stopped container",
+			Flags: []cli.Flag{
+				cli.BoolFlag{
+					Name:  "force, f",
+					Usage: "kill the container if it is still running",
+				},
+			},
+			Action: func(context *cli.Context) error {
+				if len(context.Args()) < 1 {
+					return fmt.Errorf("Missing container id")
+				}
+				return deleteOCIContainer(context.Args().Get(0), context.Bool("force"))
+			},
+		},
+	},
+}
@@ -63,13 +63,26 @@ func (d *BridgeNetworkDriver) Connect(network *Network, endpoint *Endpoint) erro
 	}
 
 	if err = netlink.LinkSetUp(&endpoint.Device); err != nil {
+		netlink.LinkDel(&endpoint.Device)
 		return fmt.Errorf("Error Add Endpoint Device: %v", err)
 	}
 	return nil
 }
 
+// 删除宿主机一端的 veth, 另一端随之删除; 容器的 network namespace 销毁时 veth 已经不存在
 func (d *BridgeNetworkDriver) Disconnect(network Network, endpoint *Endpoint) error {
-	return nil
+	_, err := net.InterfaceByName(endpoint.Device.Name)
+	if err != nil {
+		if strings.Contains(err.Error(), "no such network interface") {
+			return nil
+		}
+		return err
+	}
+	veth, err := netlink.LinkByName(endpoint.Device.Name)
+	if err != nil {
+		return err
+	}
+	return netlink.LinkDel(veth)
 }
 
 
@@ -304,18 +304,62 @@ func Connect(networkName string, cinfo *container.ContainerInfo) error {
 		Network: network,
 		PortMapping: cinfo.PortMapping,
 	}
-	// 调用网络驱动挂载和配置网络端点
+	// 调用网络驱动挂载和配置网络端点, 失败时释放已经分配的IP
 	if err = drivers[network.Driver].Connect(network, ep); err != nil {
+		releaseIP(network, ip)
 		return err
 	}
 	// 到容器的namespace配置容器网络设备IP地址
 	if err = configEndpointIpAddressAndRoute(ep, cinfo); err != nil {
+		drivers[network.Driver].Disconnect(*network, ep)
+		releaseIP(network, ip)
 		return err
 	}
 
+	cinfo.IPAddress = ep.IPAddress.String()
 	return configPortMapping(ep, cinfo)
 }
 
+// 撤销 Connect: 删除端口映射和 veth, 释放容器的IP
 func Disconnect(networkName string, cinfo *container.ContainerInfo) error {
-	return nil
+	network, ok := networks[networkName]
+	if !ok {
+		return fmt.Errorf("No Such Network: %s", networkName)
+	}
+	ep := &Endpoint{
+		ID: fmt.Sprintf("%s-%s", cinfo.Id, networkName),
+		IPAddress: net.ParseIP(cinfo.IPAddress),
+		Network: network,
+		PortMapping: cinfo.PortMapping,
+	}
+	ep.Device.Name = ep.ID[:5]
+	removePortMapping(ep)
+	if err := drivers[network.Driver].Disconnect(*network, ep); err != nil {
+		return err
+	}
+	if ep.IPAddress == nil {
+		return nil
+	}
+	return releaseIP(network, ep.IPAddress)
+}
+
+// Release 会修改传入的IP, 所以传一份拷贝
+func releaseIP(network *Network, ip net.IP) error {
+	releaseIP := make(net.IP, len(ip))
+	copy(releaseIP, ip)
+	return ipAllocator.Release(network.IpRange, &releaseIP)
+}
+
+func removePortMapping(ep *Endpoint) {
+	for _, pm := range ep.PortMapping {
+		portMapping :=strings.Split(pm, ":")
+		if len(portMapping) != 2 {
+			continue
+		}
+		iptablesCmd := fmt.Sprintf("-t nat -D PREROUTING -p tcp -m tcp --dport %s -j DNAT --to-destination %s:%s",
+			portMapping[0], ep.IPAddress.String(), portMapping[1])
+		if output, err := exec.Command("iptables", strings.Split(iptablesCmd, " ")...).CombinedOutput(); err != nil {
+			logrus.Warnf("remove port mapping %s error %v, %s", pm, err, output)
+		}
+	}
 }
@@ -9,6 +9,12 @@ package nsenter
 #include <stdlib.h>
 #include <string.h>
 #include <fcntl.h>
+#include <grp.h>
+#include <sys/prctl.h>
+#include <sys/syscall.h>
+#include <linux/capability.h>
+#include <linux/filter.h>
+#include <linux/seccomp.h>
 
 __attribute__((constructor)) void enter_namespace(void) {
 	char *mydocker_pid;
@@ -28,20 +34,131 @@ __attribute__((constructor)) void enter_namespace(void) {
 		return;
 	}
 	int i;
+	int userns = 0;
 	char nspath[1024];
-	char *namespaces[] = { "ipc", "uts", "net", "pid", "mnt" };
+	// user namespace 必须最先加入, 之后才有权限加入它所拥有的其他 namespace
+	char *namespaces[] = { "user", "ipc", "uts", "net", "pid", "cgroup", "time", "mnt" };
 
-	for (i=0; i<5; i++) {
+	for (i=0; i<8; i++) {
 		sprintf(nspath, "/proc/%s/ns/%s", mydocker_pid, namespaces[i]);
 		int fd = open(nspath, O_RDONLY);
 
 		if (setns(fd, 0) == -1) {
+			// 容器没有单独的 user namespace 时加入自身所在的 namespace 会失败, 忽略即可
 			//fprintf(stderr, "setns on %s namespace failed: %s\n", namespaces[i], strerror(errno));
 		} else {
+			if (i == 0) {
+				userns = 1;
+			}
 			//fprintf(stdout, "setns on %s namespace succeeded\n", namespaces[i]);
 		}
 		close(fd);
 	}
+	// 加入 user namespace 后切换到容器内的 root
+	if (userns) {
+		if (setgroups(0, NULL) == -1 || setgid(0) == -1 || setuid(0) == -1) {
+			fprintf(stderr, "switch to container root failed: %s\n", strerror(errno));
+			exit(1);
+		}
+	}
+	char *mydocker_cwd;
+	mydocker_cwd = getenv("mydocker_cwd");
+	if (mydocker_cwd && chdir(mydocker_cwd) == -1) {
+		fprintf(stderr, "chdir to %s failed: %s\n", mydocker_cwd, strerror(errno));
+		exit(1);
+	}
+	// 按容器的 capability 集合收缩 exec 进程的权限, bounding 集合需要在切换用户之前收缩
+	char *mydocker_caps;
+	mydocker_caps = getenv("mydocker_caps");
+	unsigned long long mask = 0;
+	if (mydocker_caps) {
+		mask = strtoull(mydocker_caps, NULL, 0);
+		for (i=0; i<64; i++) {
+			if (!(mask & (1ULL << i))) {
+				// 超出内核支持范围的 capability 会返回 EINVAL, 忽略即可
+				prctl(PR_CAPBSET_DROP, i, 0, 0, 0);
+			}
+		}
+	}
+	char *mydocker_no_new_privs;
+	mydocker_no_new_privs = getenv("mydocker_no_new_privs");
+	if (mydocker_no_new_privs && prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) == -1) {
+		fprintf(stderr, "set no_new_privs failed: %s\n", strerror(errno));
+		exit(1);
+	}
+	// 和 init 进程一样在切换用户、丢弃 CAP_SYS_ADMIN 之前安装容器的 seccomp 过滤器
+	// 每条指令编码成 16 个十六进制字符: code(4) jt(2) jf(2) k(8)
+	char *mydocker_seccomp;
+	mydocker_seccomp = getenv("mydocker_seccomp");
+	if (mydocker_seccomp) {
+		size_t len = strlen(mydocker_seccomp);
+		if (len == 0 || len % 16 != 0 || len / 16 > BPF_MAXINSNS) {
+			fprintf(stderr, "invalid seccomp filter\n");
+			exit(1);
+		}
+		struct sock_filter *filter = calloc(len / 16, sizeof(struct sock_filter));
+		if (!filter) {
+			fprintf(stderr, "alloc seccomp filter failed\n");
+			exit(1);
+		}
+		for (i=0; i<len/16; i++) {
+			unsigned int code, jt, jf, k;
+			if (sscanf(mydocker_seccomp + 16 * i, "%4x%2x%2x%8x", &code, &jt, &jf, &k) != 4) {
+				fprintf(stderr, "invalid seccomp filter\n");
+				exit(1);
+			}
+			filter[i].code = code;
+			filter[i].jt = jt;
+			filter[i].jf = jf;
+			filter[i].k = k;
+		}
+		struct sock_fprog prog = { len / 16, filter };
+		// 没有 CAP_SYS_ADMIN 时内核要求先设置 no_new_privs
+		if (prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER, &prog) == -1) {
+			if (errno != EACCES || prctl(PR_SET_NO_NEW_PRIVS, 1, 0, 0, 0) == -1 || prctl(PR_SET_SECCOMP, SECCOMP_MODE_FILTER, &prog) == -1) {
+				fprintf(stderr, "install seccomp filter failed: %s\n", strerror(errno));
+				exit(1);
+			}
+		}
+		free(filter);
+		unsetenv("mydocker_seccomp");
+	}
+	// 切换到容器进程的用户, 格式为 uid:gid:附加组1,附加组2
+	char *mydocker_user;
+	mydocker_user = getenv("mydocker_user");
+	if (mydocker_user) {
+		char *p = mydocker_user;
+		uid_t uid = strtoul(p, &p, 10);
+		gid_t gid = strtoul(*p == ':' ? p + 1 : p, &p, 10);
+		gid_t sgids[64];
+		int ngroups = 0;
+		if (*p == ':') {
+			p++;
+		}
+		while (*p && ngroups < 64) {
+			sgids[ngroups++] = strtoul(p, &p, 10);
+			if (*p == ',') {
+				p++;
+			}
+		}
+		prctl(PR_SET_KEEPCAPS, 1, 0, 0, 0);
+		if (setgroups(ngroups, sgids) == -1 || setgid(gid) == -1 || setuid(uid) == -1) {
+			fprintf(stderr, "switch to user %s failed: %s\n", mydocker_user, strerror(errno));
+			exit(1);
+		}
+		prctl(PR_SET_KEEPCAPS, 0, 0, 0, 0);
+	}
+	if (mydocker_caps) {
+		struct __user_cap_header_struct header = { _LINUX_CAPABILITY_VERSION_3, 0 };
+		struct __user_cap_data_struct data[2];
+		for (i=0; i<2; i++) {
+			data[i].effective = data[i].permitted = data[i].inheritable = (unsigned int)(mask >> (32 * i));
+		}
+		if (syscall(SYS_capset, &header, data) == -1) {
+			fprintf(stderr, "capset failed: %s\n", strerror(errno));
+			exit(1);
+		}
+	}
 	int res = system(mydocker_cmd);
 	exit(0);
 	return;
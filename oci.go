@@ -0,0 +1,208 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/cgroups"
+	"github.com/xianlubird/mydocker/container"
+	"github.com/xianlubird/mydocker/oci"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// 在状态目录中保存 OCI 配置里的 seccomp 配置, 容器通过这个文件加载
+const ociSeccompName = "seccomp.json"
+
+// 生成默认的 config.json
+func generateSpec(bundle string) error {
+	path := filepath.Join(bundle, oci.SpecConfig)
+	if _, err := os.Stat(path); err == nil {
+		return fmt.Errorf("file %s already exists", path)
+	}
+	return oci.SaveSpec(path, oci.DefaultSpec())
+}
+
+// 根据 bundle 创建容器, init 进程完成所有设置之后阻塞在 exec fifo 上, 直到 oci start
+func createOCIContainer(id, bundle string) error {
+	bundle, err := filepath.Abs(bundle)
+	if err != nil {
+		return err
+	}
+	dirURL := fmt.Sprintf(container.DefaultInfoLocation, id)
+	if _, err := os.Stat(dirURL); err == nil {
+		return fmt.Errorf("container %s already exists", id)
+	}
+	spec, err := oci.LoadSpec(filepath.Join(bundle, oci.SpecConfig))
+	if err != nil {
+		return err
+	}
+	config, err := oci.ConvertSpec(id, bundle, spec)
+	if err != nil {
+		return fmt.Errorf("convert spec error %v", err)
+	}
+	containerInfo := config.Container
+	containerInfo.Status = container.CREATED
+	// 全局 hook 在配置文件中的 hook 之前执行
+	hooks, err := container.LoadGlobalHooks()
+	if err != nil {
+		return err
+	}
+	hooks.Append(&containerInfo.Hooks)
+	containerInfo.Hooks = *hooks
+
+	if err := os.MkdirAll(dirURL, 0622); err != nil {
+		return err
+	}
+	if config.Seccomp != nil {
+		content, err := json.Marshal(config.Seccomp)
+		if err != nil {
+			destroyOCIContainer(containerInfo)
+			return err
+		}
+		containerInfo.Seccomp = filepath.Join(dirURL, ociSeccompName)
+		if err := ioutil.WriteFile(containerInfo.Seccomp, content, 0644); err != nil {
+			destroyOCIContainer(containerInfo)
+			return err
+		}
+	}
+
+	// startContainer 失败时已经结束了 init 进程并删除了 cgroup, 这里只需要删除状态目录
+	if _, err := startContainer(false, config.Args, config.Resources, containerInfo, config.Env, config.Network); err != nil {
+		deleteContainerInfo(containerInfo.Name)
+		return err
+	}
+	return nil
+}
+
+func startOCIContainer(id string) error {
+	containerInfo, err := getOCIContainer(id)
+	if err != nil {
+		return err
+	}
+	if status := ociStatus(containerInfo); status != oci.StatusCreated {
+		return fmt.Errorf("cannot start a container in %s state", status)
+	}
+	pid, _ := strconv.Atoi(containerInfo.Pid)
+	if err := container.StartExecFifo(id, pid); err != nil {
+		return err
+	}
+	containerInfo.Status = container.RUNNING
+	if err := saveContainerInfo(containerInfo); err != nil {
+		return err
+	}
+	container.RecordEvent(containerInfo, container.EventStart)
+	// poststart hook 失败时只记录日志, 不影响已经启动的容器
+	if err := container.RunHooks(containerInfo.Hooks.Poststart, containerState(containerInfo, oci.StatusRunning)); err != nil {
+		log.Warnf("Poststart hook error %v", err)
+	}
+	return nil
+}
+
+func printOCIState(id string) error {
+	containerInfo, err := getOCIContainer(id)
+	if err != nil {
+		return err
+	}
+	content, err := json.MarshalIndent(containerState(containerInfo, ociStatus(containerInfo)), "", "  ")
+	if err != nil {
+		return err
+	}
+	fmt.Fprintln(os.Stdout, string(content))
+	return nil
+}
+
+func killOCIContainer(id, signal string) error {
+	containerInfo, err := getOCIContainer(id)
+	if err != nil {
+		return err
+	}
+	sig, err := oci.ParseSignal(signal)
+	if err != nil {
+		return err
+	}
+	if status := ociStatus(containerInfo); status != oci.StatusCreated && status != oci.StatusRunning {
+		return fmt.Errorf("cannot kill a container in %s state", status)
+	}
+	pid, _ := strconv.Atoi(containerInfo.Pid)
+	return syscall.Kill(pid, sig)
+}
+
+func deleteOCIContainer(id string, force bool) error {
+	containerInfo, err := getOCIContainer(id)
+	if err != nil {
+		return err
+	}
+	status := ociStatus(containerInfo)
+	if status != oci.StatusStopped && status != oci.StatusCreated && !force {
+		return fmt.Errorf("cannot delete a container in %s state, use --force", status)
+	}
+	destroyOCIContainer(containerInfo)
+	runPoststopHooks(containerInfo)
+	return nil
+}
+
+// 杀死 init 进程, 释放 cgroup 并删除状态目录
+func destroyOCIContainer(containerInfo *container.ContainerInfo) {
+	if pid, err := strconv.Atoi(containerInfo.Pid); err == nil && pid > 0 {
+		syscall.Kill(pid, syscall.SIGKILL)
+		// 等待进程退出, 否则 cgroup 中还有进程时无法删除
+		for i := 0; i < 100 && processAlive(pid); i++ {
+			time.Sleep(10 * time.Millisecond)
+		}
+	}
+	if containerInfo.CgroupPath != "" {
+		refreshOOMKilled(containerInfo)
+		cgroups.NewCgroupManager(containerInfo.CgroupPath).Destroy()
+	}
+	deleteContainerInfo(containerInfo.Name)
+	container.RecordEvent(containerInfo, container.EventDestroy)
+}
+
+func getOCIContainer(id string) (*container.ContainerInfo, error) {
+	containerInfo, err := getContainerInfoByName(id)
+	if err != nil {
+		return nil, fmt.Errorf("container %s does not exist", id)
+	}
+	if containerInfo.Bundle == "" {
+		return nil, fmt.Errorf("container %s is not created by oci create", id)
+	}
+	return containerInfo, nil
+}
+
+// init 进程不存在或者已经退出还没有被回收时, 容器已经停止
+func ociStatus(containerInfo *container.ContainerInfo) string {
+	pid, err := strconv.Atoi(containerInfo.Pid)
+	if err != nil || pid <= 0 || !processAlive(pid) {
+		return oci.StatusStopped
+	}
+	if containerInfo.Status == container.CREATED {
+		return oci.StatusCreated
+	}
+	return oci.StatusRunning
+}
+
+func processAlive(pid int) bool {
+	stat, err := ioutil.ReadFile(fmt.Sprintf("/proc/%d/stat", pid))
+	if err != nil {
+		return false
+	}
+	// 进程名可能包含空格和括号, 状态在最后一个右括号之后
+	fields := strings.Fields(string(stat[bytes.LastIndexByte(stat, ')')+1:]))
+	return len(fields) > 0 && fields[0] != "Z"
+}
+
+func saveContainerInfo(containerInfo *container.ContainerInfo) error {
+	content, err := json.Marshal(containerInfo)
+	if err != nil {
+		return err
+	}
+	configFilePath := fmt.Sprintf(container.DefaultInfoLocation, containerInfo.Name) + container.ConfigName
+	return ioutil.WriteFile(configFilePath, content, 0622)
+}
@@ -0,0 +1,488 @@
+package oci
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/cgroups"
+	"github.com/xianlubird/mydocker/cgroups/subsystems"
+	"github.com/xianlubird/mydocker/container"
+	"github.com/xianlubird/mydocker/seccomp"
+	"math"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// 通过 annotation 指定容器连接的 mydocker 网络
+const NetworkAnnotation = "org.mydocker.network"
+
+// init 进程自己挂载这些路径, 配置中对应的挂载会被忽略
+var managedMounts = map[string]bool{
+	"/proc":          true,
+	"/dev":           true,
+	"/dev/pts":       true,
+	"/dev/shm":       true,
+	"/dev/mqueue":    true,
+	"/sys":           true,
+	"/sys/fs/cgroup": true,
+}
+
+var bindPropagations = map[string]bool{
+	"private":  true,
+	"rprivate": true,
+	"shared":   true,
+	"rshared":  true,
+	"slave":    true,
+	"rslave":   true,
+}
+
+// 由 OCI 配置转换得到的容器配置
+type Config struct {
+	Args      []string
+	Env       []string
+	Container *container.ContainerInfo
+	Resources *subsystems.ResourceConfig
+	Seccomp   *seccomp.Seccomp //为空时不过滤系统调用
+	Network   string           //需要连接的网络, 为空时不配置网络
+}
+
+// 把 bundle 中的配置转换成 mydocker 的容器配置
+func ConvertSpec(id, bundle string, spec *Spec) (*Config, error) {
+	if spec.Process == nil || len(spec.Process.Args) == 0 {
+		return nil, fmt.Errorf("process args must not be empty")
+	}
+	if spec.Root == nil || spec.Root.Path == "" {
+		return nil, fmt.Errorf("root path must not be empty")
+	}
+	if spec.Linux == nil {
+		return nil, fmt.Errorf("only linux containers are supported")
+	}
+	rootfs := spec.Root.Path
+	if !filepath.IsAbs(rootfs) {
+		rootfs = filepath.Join(bundle, rootfs)
+	}
+	info := &container.ContainerInfo{
+		Id:             id,
+		Name:           id,
+		Bundle:         bundle,
+		Rootfs:         rootfs,
+		Hostname:       spec.Hostname,
+		ReadonlyRootfs: spec.Root.Readonly,
+		MaskedPaths:    spec.Linux.MaskedPaths,
+		ReadonlyPaths:  spec.Linux.ReadonlyPaths,
+		Seccomp:        container.SeccompUnconfined,
+		CgroupPath:     cgroups.ContainerCgroupPath("", id),
+		Annotations:    spec.Annotations,
+	}
+	// cgroupsPath 是完整的 cgroup 路径, 不再加上默认的父 cgroup
+	if spec.Linux.CgroupsPath != "" {
+		if err := cgroups.ValidateCgroupParent(spec.Linux.CgroupsPath); err != nil {
+			return nil, err
+		}
+		info.CgroupPath = strings.TrimPrefix(filepath.Clean(spec.Linux.CgroupsPath), "/")
+	}
+	config := &Config{
+		Args:      spec.Process.Args,
+		Env:       spec.Process.Env,
+		Container: info,
+		Resources: &subsystems.ResourceConfig{},
+		Seccomp:   spec.Linux.Seccomp,
+	}
+
+	if err := convertProcess(spec.Process, info); err != nil {
+		return nil, err
+	}
+	if err := convertNamespaces(spec.Linux, info); err != nil {
+		return nil, err
+	}
+	if spec.Hostname != "" && info.UtsMode != "" {
+		return nil, fmt.Errorf("hostname requires a new uts namespace")
+	}
+	if err := convertMounts(bundle, spec.Mounts, info); err != nil {
+		return nil, err
+	}
+	if err := convertDevices(spec.Linux, info, config.Resources); err != nil {
+		return nil, err
+	}
+	if err := convertResources(spec.Linux.Resources, config.Resources); err != nil {
+		return nil, err
+	}
+	for key, value := range spec.Linux.Sysctl {
+		key, value, err := container.ParseSysctl(key+"="+value, info)
+		if err != nil {
+			return nil, err
+		}
+		if info.Sysctls == nil {
+			info.Sysctls = map[string]string{}
+		}
+		info.Sysctls[key] = value
+	}
+	if err := convertHooks(spec.Hooks, info); err != nil {
+		return nil, err
+	}
+	if config.Seccomp != nil {
+		if _, err := seccomp.Compile(config.Seccomp, info.Capabilities); err != nil {
+			return nil, fmt.Errorf("compile seccomp profile error %v", err)
+		}
+	}
+	// OCI 运行时一般由调用方配置网络, 只有通过 annotation 指定时才连接 mydocker 的网络
+	if info.NetMode == "" {
+		config.Network = spec.Annotations[NetworkAnnotation]
+	}
+	return config, nil
+}
+
+// rlimit 的最大值表示不限制
+func rlimitValue(v uint64) int64 {
+	if v > math.MaxInt64 {
+		return -1
+	}
+	return int64(v)
+}
+
+func convertProcess(process *Process, info *container.ContainerInfo) error {
+	info.User = fmt.Sprintf("%d:%d", process.User.UID, process.User.GID)
+	if len(process.User.AdditionalGids) > 0 {
+		log.Warnf("Additional gids %v are ignored, groups are read from /etc/group", process.User.AdditionalGids)
+	}
+	if process.Cwd == "" || !filepath.IsAbs(process.Cwd) {
+		return fmt.Errorf("process cwd %s must be absolute", process.Cwd)
+	}
+	info.WorkingDir = process.Cwd
+
+	// mydocker 的容器进程只有一个 capability 集合, 使用 bounding 集合, 没有配置时不保留任何 capability
+	info.Capabilities = []string{}
+	if process.Capabilities != nil && process.Capabilities.Bounding != nil {
+		if _, err := container.CapabilityMask(process.Capabilities.Bounding); err != nil {
+			return err
+		}
+		info.Capabilities = process.Capabilities.Bounding
+	}
+	for _, r := range process.Rlimits {
+		name := strings.ToLower(strings.TrimPrefix(r.Type, "RLIMIT_"))
+		ulimit, err := container.ParseUlimit(fmt.Sprintf("%s=%d:%d", name, rlimitValue(r.Soft), rlimitValue(r.Hard)))
+		if err != nil {
+			return err
+		}
+		info.Ulimits = append(info.Ulimits, *ulimit)
+	}
+	info.NoNewPrivileges = process.NoNewPrivileges
+	if process.OOMScoreAdj != nil {
+		if err := container.ValidateOomScoreAdj(*process.OOMScoreAdj); err != nil {
+			return err
+		}
+		info.OomScoreAdj = *process.OOMScoreAdj
+	}
+	return nil
+}
+
+// 配置中没有列出的 namespace 使用宿主机的, path 不为空时加入这个 namespace
+func convertNamespaces(linux *Linux, info *container.ContainerInfo) error {
+	modes := map[string]*string{
+		"pid":     &info.PidMode,
+		"network": &info.NetMode,
+		"ipc":     &info.IpcMode,
+		"uts":     &info.UtsMode,
+	}
+	for _, mode := range modes {
+		*mode = container.NamespaceModeHost
+	}
+	info.CgroupnsMode = container.NamespaceModeHost
+	hasMount, hasTime := false, false
+	for _, ns := range linux.Namespaces {
+		if mode, ok := modes[ns.Type]; ok {
+			if ns.Path != "" && !filepath.IsAbs(ns.Path) {
+				return fmt.Errorf("%s namespace path %s must be absolute", ns.Type, ns.Path)
+			}
+			*mode = ns.Path
+			continue
+		}
+		if ns.Path != "" {
+			return fmt.Errorf("joining an existing %s namespace is not supported", ns.Type)
+		}
+		switch ns.Type {
+		case "mount":
+			hasMount = true
+		case "cgroup":
+			info.CgroupnsMode = container.NamespaceModePrivate
+		case "user":
+			if len(linux.UIDMappings) == 0 || len(linux.GIDMappings) == 0 {
+				return fmt.Errorf("user namespace requires uid and gid mappings")
+			}
+			info.UidMappings = convertIDMappings(linux.UIDMappings)
+			info.GidMappings = convertIDMappings(linux.GIDMappings)
+			if _, ok := container.HostID(info.UidMappings, 0); !ok {
+				return fmt.Errorf("uid mappings must map container root")
+			}
+			if _, ok := container.HostID(info.GidMappings, 0); !ok {
+				return fmt.Errorf("gid mappings must map container root")
+			}
+		case "time":
+			hasTime = true
+		default:
+			return fmt.Errorf("unknown namespace type %s", ns.Type)
+		}
+	}
+	if !hasMount {
+		return fmt.Errorf("mount namespace is required")
+	}
+	if !hasTime {
+		if len(linux.TimeOffsets) > 0 {
+			return fmt.Errorf("time offsets require a time namespace")
+		}
+		return nil
+	}
+	// 只有存在偏移时才会创建 time namespace, 没有配置偏移时写入零偏移
+	info.TimeOffsets = map[string]container.TimeOffset{"monotonic": {}}
+	for clock, offset := range linux.TimeOffsets {
+		if clock != "monotonic" && clock != "boottime" {
+			return fmt.Errorf("invalid time offset clock %s", clock)
+		}
+		info.TimeOffsets[clock] = container.TimeOffset{Secs: offset.Secs, Nanosecs: offset.Nanosecs}
+	}
+	return nil
+}
+
+func convertIDMappings(mappings []LinuxIDMapping) []container.IDMap {
+	var idMaps []container.IDMap
+	for _, m := range mappings {
+		idMaps = append(idMaps, container.IDMap{ContainerID: int(m.ContainerID), HostID: int(m.HostID), Size: int(m.Size)})
+	}
+	return idMaps
+}
+
+// 只支持 bind 和 tmpfs 挂载, 相对路径的 bind 源相对于 bundle 目录
+func convertMounts(bundle string, mounts []Mount, info *container.ContainerInfo) error {
+	for _, m := range mounts {
+		dest := filepath.Clean(m.Destination)
+		if managedMounts[dest] {
+			if dest == "/dev/shm" {
+				for _, opt := range m.Options {
+					if strings.HasPrefix(opt, "size=") {
+						info.ShmSize = strings.TrimPrefix(opt, "size=")
+					}
+				}
+			}
+			continue
+		}
+		mount := container.Mount{Destination: m.Destination}
+		isBind := m.Type == "bind"
+		for _, opt := range m.Options {
+			if opt == "bind" || opt == "rbind" {
+				isBind = true
+			}
+		}
+		switch {
+		case isBind:
+			mount.Type = container.MountTypeBind
+			mount.Source = m.Source
+			if !filepath.IsAbs(mount.Source) {
+				mount.Source = filepath.Join(bundle, mount.Source)
+			}
+		case m.Type == "tmpfs":
+			mount.Type = container.MountTypeTmpfs
+		default:
+			return fmt.Errorf("unsupported mount type %s for %s", m.Type, m.Destination)
+		}
+		for _, opt := range m.Options {
+			switch {
+			case opt == "ro":
+				mount.ReadOnly = true
+			case opt == "rw":
+				mount.ReadOnly = false
+			case isBind && bindPropagations[opt]:
+				mount.Propagation = opt
+			case !isBind && strings.HasPrefix(opt, "size="):
+				mount.TmpfsSize = strings.TrimPrefix(opt, "size=")
+			}
+		}
+		if err := mount.Validate(); err != nil {
+			return err
+		}
+		info.Mounts = append(info.Mounts, mount)
+	}
+	if info.ShmSize != "" {
+		return container.ValidateShmSize(info.ShmSize)
+	}
+	return nil
+}
+
+// 配置中的设备会在容器内创建并允许访问, devices cgroup 规则之后还会加上默认设备的规则
+func convertDevices(linux *Linux, info *container.ContainerInfo, res *subsystems.ResourceConfig) error {
+	var rules []subsystems.DeviceRule
+	if linux.Resources != nil {
+		for _, d := range linux.Resources.Devices {
+			rule := subsystems.DeviceRule{Type: d.Type, Major: -1, Minor: -1, Access: d.Access}
+			if rule.Type == "" {
+				rule.Type = "a"
+			}
+			if rule.Access == "" {
+				rule.Access = "rwm"
+			}
+			if d.Major != nil {
+				rule.Major = *d.Major
+			}
+			if d.Minor != nil {
+				rule.Minor = *d.Minor
+			}
+			if _, err := subsystems.ParseDeviceRule(rule.String()); err != nil {
+				return err
+			}
+			if d.Allow {
+				rules = append(rules, rule)
+				continue
+			}
+			// devices cgroup 先拒绝所有设备再逐条允许, 只能表示拒绝所有设备的规则
+			if rule.Type != "a" || rule.Major != -1 || rule.Minor != -1 || rule.Access != "rwm" {
+				return fmt.Errorf("device cgroup rule deny %s is not supported", rule)
+			}
+			rules = nil
+		}
+	}
+	rules = append(rules, subsystems.DefaultDeviceRules...)
+
+	for _, d := range linux.Devices {
+		device := container.Device{
+			Path:        filepath.Clean(d.Path),
+			Major:       int(d.Major),
+			Minor:       int(d.Minor),
+			FileMode:    0666,
+			Permissions: "rwm",
+		}
+		if !filepath.IsAbs(d.Path) {
+			return fmt.Errorf("device path %s must be absolute", d.Path)
+		}
+		ruleType := "c"
+		switch d.Type {
+		case "c", "u":
+			device.Type = syscall.S_IFCHR
+		case "b":
+			device.Type = syscall.S_IFBLK
+			ruleType = "b"
+		default:
+			return fmt.Errorf("unsupported device type %s for %s", d.Type, d.Path)
+		}
+		if d.FileMode != nil {
+			device.FileMode = *d.FileMode
+		}
+		info.Devices = append(info.Devices, device)
+		rules = append(rules, subsystems.DeviceRule{Type: ruleType, Major: d.Major, Minor: d.Minor, Access: "rwm"})
+	}
+	res.DeviceRules = rules
+	return nil
+}
+
+func convertResources(resources *LinuxResources, res *subsystems.ResourceConfig) error {
+	if resources == nil {
+		return nil
+	}
+	if memory := resources.Memory; memory != nil {
+		if memory.Limit != nil {
+			if *memory.Limit <= 0 {
+				return fmt.Errorf("invalid memory limit %d", *memory.Limit)
+			}
+			res.MemoryLimit = *memory.Limit
+		}
+		if memory.Swap != nil {
+			res.MemorySwap = *memory.Swap
+		}
+		if memory.Reservation != nil {
+			res.MemoryReservation = *memory.Reservation
+		}
+		if memory.Kernel != nil {
+			res.KernelMemory = *memory.Kernel
+		}
+		if memory.Swappiness != nil {
+			swappiness := int64(*memory.Swappiness)
+			res.MemorySwappiness = &swappiness
+		}
+		if memory.DisableOOMKiller != nil {
+			res.OomKillDisable = *memory.DisableOOMKiller
+		}
+	}
+	if cpu := resources.CPU; cpu != nil {
+		if cpu.Shares != nil {
+			res.CpuShare = *cpu.Shares
+		}
+		if cpu.Quota != nil {
+			res.CpuQuota = *cpu.Quota
+		}
+		if cpu.Period != nil {
+			res.CpuPeriod = *cpu.Period
+		}
+		if cpu.RealtimeRuntime != nil {
+			res.CpuRtRuntime = *cpu.RealtimeRuntime
+		}
+		if cpu.RealtimePeriod != nil {
+			res.CpuRtPeriod = *cpu.RealtimePeriod
+		}
+		for spec, list := range map[string]*subsystems.CPUList{
+			cpu.Cpus: &res.CpuSet,
+			cpu.Mems: &res.CpusetMems,
+		} {
+			if spec == "" {
+				continue
+			}
+			var err error
+			if *list, err = subsystems.ParseCPUList(spec); err != nil {
+				return err
+			}
+		}
+	}
+	if pids := resources.Pids; pids != nil {
+		res.PidsLimit = -1
+		if pids.Limit > 0 {
+			res.PidsLimit = pids.Limit
+		}
+	}
+	if blkio := resources.BlockIO; blkio != nil {
+		if blkio.Weight != nil {
+			res.BlkioWeight = *blkio.Weight
+		}
+		for _, d := range blkio.WeightDevice {
+			if d.Weight == nil {
+				continue
+			}
+			if err := subsystems.ValidateBlkioWeight(int(*d.Weight)); err != nil {
+				return err
+			}
+			res.BlkioWeightDevice = append(res.BlkioWeightDevice, subsystems.WeightDevice{Major: d.Major, Minor: d.Minor, Weight: *d.Weight})
+		}
+		res.BlkioDeviceReadBps = convertThrottleDevices(blkio.ThrottleReadBpsDevice)
+		res.BlkioDeviceWriteBps = convertThrottleDevices(blkio.ThrottleWriteBpsDevice)
+		res.BlkioDeviceReadIOps = convertThrottleDevices(blkio.ThrottleReadIOPSDevice)
+		res.BlkioDeviceWriteIOps = convertThrottleDevices(blkio.ThrottleWriteIOPSDevice)
+	}
+	for _, l := range resources.HugepageLimits {
+		hugepage, err := subsystems.ParseHugetlbLimit(fmt.Sprintf("%s:%d", l.PageSize, l.Limit))
+		if err != nil {
+			return err
+		}
+		res.HugetlbLimit = append(res.HugetlbLimit, *hugepage)
+	}
+	return res.Validate()
+}
+
+func convertThrottleDevices(devices []LinuxThrottleDevice) []subsystems.ThrottleDevice {
+	var converted []subsystems.ThrottleDevice
+	for _, d := range devices {
+		converted = append(converted, subsystems.ThrottleDevice(d))
+	}
+	return converted
+}
+
+// createRuntime hook 和 prestart 一样在宿主机上执行, 容器 namespace 中执行的 hook 不支持
+func convertHooks(hooks *Hooks, info *container.ContainerInfo) error {
+	if hooks == nil {
+		return nil
+	}
+	if len(hooks.CreateContainer) > 0 || len(hooks.StartContainer) > 0 {
+		return fmt.Errorf("createContainer and startContainer hooks are not supported")
+	}
+	info.Hooks = container.Hooks{
+		Prestart:  append(append([]container.Hook{}, hooks.Prestart...), hooks.CreateRuntime...),
+		Poststart: hooks.Poststart,
+		Poststop:  hooks.Poststop,
+	}
+	return container.ValidateHooks(&info.Hooks)
+}
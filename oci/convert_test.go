@@ -0,0 +1,152 @@
+package oci
+
+import (
+	"github.com/xianlubird/mydocker/container"
+	"syscall"
+	"testing"
+)
+
+func TestConvertDefaultSpec(t *testing.T) {
+	spec := DefaultSpec()
+	spec.Mounts = append(spec.Mounts,
+		Mount{Destination: "/data", Type: "bind", Source: "/tmp", Options: []string{"rbind", "ro", "rslave"}},
+		Mount{Destination: "/run", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "size=1m"}},
+	)
+	spec.Annotations = map[string]string{NetworkAnnotation: "testbridge"}
+	limit := int64(1 << 20)
+	spec.Linux.Resources.Memory = &LinuxMemory{Limit: &limit}
+	spec.Linux.Resources.Pids = &LinuxPids{Limit: 100}
+	spec.Linux.Resources.BlockIO = &LinuxBlockIO{ThrottleReadBpsDevice: []LinuxThrottleDevice{{Major: 8, Minor: 0, Rate: 1 << 20}}}
+	spec.Linux.Devices = []LinuxDevice{{Path: "/dev/fuse", Type: "c", Major: 10, Minor: 229}}
+
+	config, err := ConvertSpec("abc", "/bundle", spec)
+	if err != nil {
+		t.Fatalf("convert spec %v", err)
+	}
+	info := config.Container
+	if info.Rootfs != "/bundle/rootfs" || !info.ReadonlyRootfs || info.CgroupPath != "mydocker/abc" {
+		t.Errorf("rootfs %s readonly %v cgroup %s", info.Rootfs, info.ReadonlyRootfs, info.CgroupPath)
+	}
+	if info.User != "0:0" || info.WorkingDir != "/" || info.Hostname != "mydocker" {
+		t.Errorf("user %s cwd %s hostname %s", info.User, info.WorkingDir, info.Hostname)
+	}
+	if info.NetMode != "" || info.PidMode != "" || info.CgroupnsMode != container.NamespaceModePrivate {
+		t.Errorf("namespace modes %+v", info)
+	}
+	if config.Network != "testbridge" {
+		t.Errorf("network %s", config.Network)
+	}
+	if len(info.Ulimits) != 1 || info.Ulimits[0] != (container.Rlimit{Name: "nofile", Soft: 1024, Hard: 1024}) {
+		t.Errorf("ulimits %+v", info.Ulimits)
+	}
+	if info.ShmSize != "65536k" || len(info.Mounts) != 2 {
+		t.Fatalf("shm size %s mounts %+v", info.ShmSize, info.Mounts)
+	}
+	if m := info.Mounts[0]; m.Type != container.MountTypeBind || !m.ReadOnly || m.Propagation != "rslave" {
+		t.Errorf("bind mount %+v", m)
+	}
+	if m := info.Mounts[1]; m.Type != container.MountTypeTmpfs || m.TmpfsSize != "1m" {
+		t.Errorf("tmpfs mount %+v", m)
+	}
+	if config.Resources.MemoryLimit != 1<<20 || config.Resources.PidsLimit != 100 {
+		t.Errorf("memory limit %d pids limit %d", config.Resources.MemoryLimit, config.Resources.PidsLimit)
+	}
+	if len(info.Devices) != 1 || info.Devices[0].Type != syscall.S_IFCHR || info.Devices[0].Major != 10 {
+		t.Errorf("devices %+v", info.Devices)
+	}
+	if bps := config.Resources.BlkioDeviceReadBps; len(bps) != 1 || bps[0].String() != "8:0 1048576" {
+		t.Errorf("blkio read bps %v", bps)
+	}
+	rules := config.Resources.DeviceRules
+	if len(rules) == 0 || rules[len(rules)-1].String() != "c 10:229 rwm" {
+		t.Errorf("device rules %v", rules)
+	}
+}
+
+func TestConvertNamespaces(t *testing.T) {
+	spec := DefaultSpec()
+	spec.Linux.Namespaces = []LinuxNamespace{
+		{Type: "mount"},
+		{Type: "network", Path: "/var/run/netns/test"},
+		{Type: "user"},
+		{Type: "time"},
+	}
+	spec.Hostname = ""
+	spec.Linux.UIDMappings = []LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}}
+	spec.Linux.GIDMappings = []LinuxIDMapping{{ContainerID: 0, HostID: 100000, Size: 65536}}
+	spec.Linux.TimeOffsets = map[string]LinuxTimeOffset{"boottime": {Secs: 10}}
+	config, err := ConvertSpec("abc", "/bundle", spec)
+	if err != nil {
+		t.Fatalf("convert spec %v", err)
+	}
+	info := config.Container
+	if info.NetMode != "/var/run/netns/test" || info.PidMode != container.NamespaceModeHost || info.CgroupnsMode != container.NamespaceModeHost {
+		t.Errorf("namespace modes net %s pid %s cgroupns %s", info.NetMode, info.PidMode, info.CgroupnsMode)
+	}
+	if len(info.UidMappings) != 1 || info.UidMappings[0].HostID != 100000 {
+		t.Errorf("uid mappings %+v", info.UidMappings)
+	}
+	if info.TimeOffsets["boottime"].Secs != 10 {
+		t.Errorf("time offsets %+v", info.TimeOffsets)
+	}
+
+	for _, namespaces := range [][]LinuxNamespace{
+		{{Type: "pid"}},
+		{{Type: "mount", Path: "/proc/1/ns/mnt"}},
+		{{Type: "mount"}, {Type: "user"}, {Type: "foo"}},
+	} {
+		spec := DefaultSpec()
+		spec.Linux.Namespaces = namespaces
+		if _, err := ConvertSpec("abc", "/bundle", spec); err == nil {
+			t.Errorf("namespaces %+v should fail", namespaces)
+		}
+	}
+}
+
+func TestConvertInvalidSpec(t *testing.T) {
+	cases := map[string]func(*Spec){
+		"mount type": func(s *Spec) { s.Mounts = append(s.Mounts, Mount{Destination: "/x", Type: "nfs"}) },
+		"capability": func(s *Spec) { s.Process.Capabilities.Bounding = []string{"CAP_FOO"} },
+		"rlimit":     func(s *Spec) { s.Process.Rlimits = []POSIXRlimit{{Type: "RLIMIT_FOO"}} },
+		"cwd":        func(s *Spec) { s.Process.Cwd = "tmp" },
+		"sysctl":     func(s *Spec) { s.Linux.Sysctl = map[string]string{"kernel.domainname": "x"} },
+		"cpu quota": func(s *Spec) {
+			quota := int64(100)
+			s.Linux.Resources.CPU = &LinuxCPU{Quota: &quota}
+		},
+		"blkio weight": func(s *Spec) {
+			weight := uint16(5)
+			s.Linux.Resources.BlockIO = &LinuxBlockIO{Weight: &weight}
+		},
+		"device deny": func(s *Spec) {
+			s.Linux.Resources.Devices = []LinuxDeviceCgroup{{Allow: false, Type: "c", Access: "rwm"}}
+		},
+		"hook": func(s *Spec) { s.Hooks = &Hooks{StartContainer: []container.Hook{{Path: "/bin/true"}}} },
+		"hook timeout": func(s *Spec) {
+			timeout := 0
+			s.Hooks = &Hooks{Prestart: []container.Hook{{Path: "/bin/true", Timeout: &timeout}}}
+		},
+		"hostname":      func(s *Spec) { s.Linux.Namespaces = []LinuxNamespace{{Type: "mount"}} },
+		"empty process": func(s *Spec) { s.Process.Args = nil },
+	}
+	for name, modify := range cases {
+		spec := DefaultSpec()
+		modify(spec)
+		if _, err := ConvertSpec("abc", "/bundle", spec); err == nil {
+			t.Errorf("%s should fail", name)
+		}
+	}
+}
+
+func TestParseSignal(t *testing.T) {
+	for s, want := range map[string]syscall.Signal{"KILL": syscall.SIGKILL, "sigterm": syscall.SIGTERM, "10": syscall.SIGUSR1} {
+		if sig, err := ParseSignal(s); err != nil || sig != want {
+			t.Errorf("parse signal %s got %v %v", s, sig, err)
+		}
+	}
+	for _, s := range []string{"FOO", "0", "100"} {
+		if _, err := ParseSignal(s); err == nil {
+			t.Errorf("parse signal %s should fail", s)
+		}
+	}
+}
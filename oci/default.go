@@ -0,0 +1,61 @@
+package oci
+
+import (
+	"github.com/xianlubird/mydocker/container"
+)
+
+// mydocker spec 生成的默认配置, 和 mydocker run 的默认安全设置一致
+func DefaultSpec() *Spec {
+	caps := append([]string{}, container.DefaultCapabilities...)
+	return &Spec{
+		Version: Version,
+		Process: &Process{
+			User: User{UID: 0, GID: 0},
+			Args: []string{"sh"},
+			Env: []string{
+				"PATH=/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin",
+				"TERM=xterm",
+			},
+			Cwd: "/",
+			Capabilities: &LinuxCapabilities{
+				Bounding:  caps,
+				Effective: caps,
+				Permitted: caps,
+			},
+			Rlimits: []POSIXRlimit{
+				{Type: "RLIMIT_NOFILE", Hard: 1024, Soft: 1024},
+			},
+			NoNewPrivileges: true,
+		},
+		Root: &Root{
+			Path:     "rootfs",
+			Readonly: true,
+		},
+		Hostname: "mydocker",
+		Mounts: []Mount{
+			{Destination: "/proc", Type: "proc", Source: "proc"},
+			{Destination: "/dev", Type: "tmpfs", Source: "tmpfs", Options: []string{"nosuid", "strictatime", "mode=755", "size=65536k"}},
+			{Destination: "/dev/pts", Type: "devpts", Source: "devpts", Options: []string{"nosuid", "noexec", "newinstance", "ptmxmode=0666", "mode=0620"}},
+			{Destination: "/dev/shm", Type: "tmpfs", Source: "shm", Options: []string{"nosuid", "noexec", "nodev", "mode=1777", "size=65536k"}},
+			{Destination: "/dev/mqueue", Type: "mqueue", Source: "mqueue", Options: []string{"nosuid", "noexec", "nodev"}},
+			{Destination: "/sys", Type: "sysfs", Source: "sysfs", Options: []string{"nosuid", "noexec", "nodev", "ro"}},
+		},
+		Linux: &Linux{
+			Resources: &LinuxResources{
+				Devices: []LinuxDeviceCgroup{
+					{Allow: false, Access: "rwm"},
+				},
+			},
+			Namespaces: []LinuxNamespace{
+				{Type: "pid"},
+				{Type: "network"},
+				{Type: "ipc"},
+				{Type: "uts"},
+				{Type: "mount"},
+				{Type: "cgroup"},
+			},
+			MaskedPaths:   append([]string{}, container.DefaultMaskedPaths...),
+			ReadonlyPaths: append([]string{}, container.DefaultReadonlyPaths...),
+		},
+	}
+}
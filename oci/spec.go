@@ -0,0 +1,208 @@
+package oci
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/xianlubird/mydocker/container"
+	"github.com/xianlubird/mydocker/seccomp"
+	"io/ioutil"
+	"os"
+)
+
+// 支持的 OCI runtime-spec 版本
+const Version = "1.0.2"
+
+// bundle 中的配置文件名
+const SpecConfig = "config.json"
+
+// OCI runtime-spec 的配置文件, 只包含 mydocker 支持的字段
+type Spec struct {
+	Version     string            `json:"ociVersion"`
+	Process     *Process          `json:"process,omitempty"`
+	Root        *Root             `json:"root,omitempty"`
+	Hostname    string            `json:"hostname,omitempty"`
+	Mounts      []Mount           `json:"mounts,omitempty"`
+	Hooks       *Hooks            `json:"hooks,omitempty"`
+	Annotations map[string]string `json:"annotations,omitempty"`
+	Linux       *Linux            `json:"linux,omitempty"`
+}
+
+type Process struct {
+	Terminal        bool               `json:"terminal,omitempty"`
+	User            User               `json:"user"`
+	Args            []string           `json:"args"`
+	Env             []string           `json:"env,omitempty"`
+	Cwd             string             `json:"cwd"`
+	Capabilities    *LinuxCapabilities `json:"capabilities,omitempty"`
+	Rlimits         []POSIXRlimit      `json:"rlimits,omitempty"`
+	NoNewPrivileges bool               `json:"noNewPrivileges,omitempty"`
+	OOMScoreAdj     *int               `json:"oomScoreAdj,omitempty"`
+}
+
+type User struct {
+	UID            uint32   `json:"uid"`
+	GID            uint32   `json:"gid"`
+	AdditionalGids []uint32 `json:"additionalGids,omitempty"`
+}
+
+type LinuxCapabilities struct {
+	Bounding    []string `json:"bounding,omitempty"`
+	Effective   []string `json:"effective,omitempty"`
+	Inheritable []string `json:"inheritable,omitempty"`
+	Permitted   []string `json:"permitted,omitempty"`
+	Ambient     []string `json:"ambient,omitempty"`
+}
+
+type POSIXRlimit struct {
+	Type string `json:"type"`
+	Hard uint64 `json:"hard"`
+	Soft uint64 `json:"soft"`
+}
+
+type Root struct {
+	Path     string `json:"path"`
+	Readonly bool   `json:"readonly,omitempty"`
+}
+
+type Mount struct {
+	Destination string   `json:"destination"`
+	Type        string   `json:"type,omitempty"`
+	Source      string   `json:"source,omitempty"`
+	Options     []string `json:"options,omitempty"`
+}
+
+type Hooks struct {
+	Prestart        []container.Hook `json:"prestart,omitempty"`
+	CreateRuntime   []container.Hook `json:"createRuntime,omitempty"`
+	CreateContainer []container.Hook `json:"createContainer,omitempty"`
+	StartContainer  []container.Hook `json:"startContainer,omitempty"`
+	Poststart       []container.Hook `json:"poststart,omitempty"`
+	Poststop        []container.Hook `json:"poststop,omitempty"`
+}
+
+type Linux struct {
+	UIDMappings   []LinuxIDMapping           `json:"uidMappings,omitempty"`
+	GIDMappings   []LinuxIDMapping           `json:"gidMappings,omitempty"`
+	Sysctl        map[string]string          `json:"sysctl,omitempty"`
+	Resources     *LinuxResources            `json:"resources,omitempty"`
+	CgroupsPath   string                     `json:"cgroupsPath,omitempty"`
+	Namespaces    []LinuxNamespace           `json:"namespaces,omitempty"`
+	Devices       []LinuxDevice              `json:"devices,omitempty"`
+	Seccomp       *seccomp.Seccomp           `json:"seccomp,omitempty"`
+	MaskedPaths   []string                   `json:"maskedPaths,omitempty"`
+	ReadonlyPaths []string                   `json:"readonlyPaths,omitempty"`
+	TimeOffsets   map[string]LinuxTimeOffset `json:"timeOffsets,omitempty"`
+}
+
+type LinuxIDMapping struct {
+	ContainerID uint32 `json:"containerID"`
+	HostID      uint32 `json:"hostID"`
+	Size        uint32 `json:"size"`
+}
+
+type LinuxNamespace struct {
+	Type string `json:"type"`
+	Path string `json:"path,omitempty"`
+}
+
+type LinuxDevice struct {
+	Path     string       `json:"path"`
+	Type     string       `json:"type"`
+	Major    int64        `json:"major"`
+	Minor    int64        `json:"minor"`
+	FileMode *os.FileMode `json:"fileMode,omitempty"`
+}
+
+type LinuxTimeOffset struct {
+	Secs     int64  `json:"secs,omitempty"`
+	Nanosecs uint32 `json:"nanosecs,omitempty"`
+}
+
+type LinuxResources struct {
+	Devices        []LinuxDeviceCgroup  `json:"devices,omitempty"`
+	Memory         *LinuxMemory         `json:"memory,omitempty"`
+	CPU            *LinuxCPU            `json:"cpu,omitempty"`
+	Pids           *LinuxPids           `json:"pids,omitempty"`
+	BlockIO        *LinuxBlockIO        `json:"blockIO,omitempty"`
+	HugepageLimits []LinuxHugepageLimit `json:"hugepageLimits,omitempty"`
+}
+
+// Major/Minor 为空表示所有设备号
+type LinuxDeviceCgroup struct {
+	Allow  bool   `json:"allow"`
+	Type   string `json:"type,omitempty"`
+	Major  *int64 `json:"major,omitempty"`
+	Minor  *int64 `json:"minor,omitempty"`
+	Access string `json:"access,omitempty"`
+}
+
+type LinuxMemory struct {
+	Limit            *int64  `json:"limit,omitempty"`
+	Reservation      *int64  `json:"reservation,omitempty"`
+	Swap             *int64  `json:"swap,omitempty"` //内存加 swap 的总量
+	Kernel           *int64  `json:"kernel,omitempty"`
+	Swappiness       *uint64 `json:"swappiness,omitempty"`
+	DisableOOMKiller *bool   `json:"disableOOMKiller,omitempty"`
+}
+
+type LinuxCPU struct {
+	Shares          *uint64 `json:"shares,omitempty"`
+	Quota           *int64  `json:"quota,omitempty"`
+	Period          *uint64 `json:"period,omitempty"`
+	RealtimeRuntime *int64  `json:"realtimeRuntime,omitempty"`
+	RealtimePeriod  *uint64 `json:"realtimePeriod,omitempty"`
+	Cpus            string  `json:"cpus,omitempty"`
+	Mems            string  `json:"mems,omitempty"`
+}
+
+// limit 为 0 或者负数表示不限制
+type LinuxPids struct {
+	Limit int64 `json:"limit"`
+}
+
+// PageSize 的格式和 hugetlb 接口文件名中的相同, 如 2MB
+type LinuxHugepageLimit struct {
+	PageSize string `json:"pageSize"`
+	Limit    uint64 `json:"limit"`
+}
+
+type LinuxBlockIO struct {
+	Weight                  *uint16               `json:"weight,omitempty"`
+	WeightDevice            []LinuxWeightDevice   `json:"weightDevice,omitempty"`
+	ThrottleReadBpsDevice   []LinuxThrottleDevice `json:"throttleReadBpsDevice,omitempty"`
+	ThrottleWriteBpsDevice  []LinuxThrottleDevice `json:"throttleWriteBpsDevice,omitempty"`
+	ThrottleReadIOPSDevice  []LinuxThrottleDevice `json:"throttleReadIOPSDevice,omitempty"`
+	ThrottleWriteIOPSDevice []LinuxThrottleDevice `json:"throttleWriteIOPSDevice,omitempty"`
+}
+
+type LinuxWeightDevice struct {
+	Major  int64   `json:"major"`
+	Minor  int64   `json:"minor"`
+	Weight *uint16 `json:"weight,omitempty"`
+}
+
+type LinuxThrottleDevice struct {
+	Major int64  `json:"major"`
+	Minor int64  `json:"minor"`
+	Rate  uint64 `json:"rate"`
+}
+
+func LoadSpec(path string) (*Spec, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read spec %s error %v", path, err)
+	}
+	var spec Spec
+	if err := json.Unmarshal(content, &spec); err != nil {
+		return nil, fmt.Errorf("decode spec %s error %v", path, err)
+	}
+	return &spec, nil
+}
+
+func SaveSpec(path string, spec *Spec) error {
+	content, err := json.MarshalIndent(spec, "", "\t")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, content, 0644)
+}
@@ -0,0 +1,48 @@
+package oci
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// oci state 中的容器状态
+const (
+	StatusCreating = "creating"
+	StatusCreated  = "created"
+	StatusRunning  = "running"
+	StatusStopped  = "stopped"
+)
+
+var signals = map[string]syscall.Signal{
+	"ABRT":  syscall.SIGABRT,
+	"ALRM":  syscall.SIGALRM,
+	"CONT":  syscall.SIGCONT,
+	"HUP":   syscall.SIGHUP,
+	"INT":   syscall.SIGINT,
+	"KILL":  syscall.SIGKILL,
+	"PIPE":  syscall.SIGPIPE,
+	"QUIT":  syscall.SIGQUIT,
+	"STOP":  syscall.SIGSTOP,
+	"TERM":  syscall.SIGTERM,
+	"TSTP":  syscall.SIGTSTP,
+	"USR1":  syscall.SIGUSR1,
+	"USR2":  syscall.SIGUSR2,
+	"WINCH": syscall.SIGWINCH,
+}
+
+// 解析 oci kill 的信号参数, 支持 KILL、SIGKILL 和信号编号
+func ParseSignal(s string) (syscall.Signal, error) {
+	if n, err := strconv.Atoi(s); err == nil {
+		if n <= 0 || n > 64 {
+			return 0, fmt.Errorf("invalid signal %s", s)
+		}
+		return syscall.Signal(n), nil
+	}
+	sig, ok := signals[strings.TrimPrefix(strings.ToUpper(s), "SIG")]
+	if !ok {
+		return 0, fmt.Errorf("unknown signal %s", s)
+	}
+	return sig, nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	log "github.com/Sirupsen/logrus"
+)
+
+// 启动容器的每一步完成之后注册对应的撤销操作, 后面的步骤失败时按相反的顺序撤销已经完成的步骤
+type rollback struct {
+	steps []rollbackStep
+}
+
+type rollbackStep struct {
+	name string
+	undo func() error
+}
+
+func (r *rollback) add(name string, undo func() error) {
+	r.steps = append(r.steps, rollbackStep{name: name, undo: undo})
+}
+
+// 某一步撤销失败时只记录日志, 继续撤销前面的步骤
+func (r *rollback) run() {
+	for i := len(r.steps) - 1; i >= 0; i-- {
+		if err := r.steps[i].undo(); err != nil {
+			log.Warnf("Rollback %s error %v", r.steps[i].name, err)
+		}
+	}
+	r.steps = nil
+}
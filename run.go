@@ -8,86 +8,305 @@ import (
 	"github.com/xianlubird/mydocker/cgroups/subsystems"
 	"github.com/xianlubird/mydocker/container"
 	"github.com/xianlubird/mydocker/network"
+	"github.com/xianlubird/mydocker/oci"
 	"math/rand"
 	"os"
+	"os/exec"
+	"path/filepath"
 	"strconv"
 	"strings"
 	"time"
 )
 
-func Run(tty bool, comArray []string, res *subsystems.ResourceConfig, containerName, volume, imageName string,
-	envSlice []string, nw string, portmapping []string) {
+func Run(tty bool, comArray []string, res *subsystems.ResourceConfig, containerInfo *container.ContainerInfo,
+	envSlice []string, nw string) error {
 	containerID := randStringBytes(10)
-	if containerName == "" {
-		containerName = containerID
+	if containerInfo.Name == "" {
+		containerInfo.Name = containerID
 	}
+	containerInfo.Id = containerID
+	// 失败时会删除这个名字的状态目录和 workspace, 名字已经被使用时不能继续, 否则会删掉另一个容器的数据
+	configFile := fmt.Sprintf(container.DefaultInfoLocation, containerInfo.Name) + container.ConfigName
+	if _, err := os.Stat(configFile); err == nil {
+		return fmt.Errorf("container name %s is already in use", containerInfo.Name)
+	}
+	// use containerID as cgroup name
+	containerInfo.CgroupPath = cgroups.ContainerCgroupPath(containerInfo.CgroupParent, containerID)
 
-	parent, writePipe := container.NewParentProcess(tty, containerName, volume, imageName, envSlice)
-	if parent == nil {
-		log.Errorf("New parent process error")
-		return
+	// startContainer 失败时已经撤销了创建的 cgroup、网络和 workspace
+	parent, err := startContainer(tty, comArray, res, containerInfo, envSlice, nw)
+	if err != nil {
+		return err
+	}
+	cgroupManager := cgroups.NewCgroupManager(containerInfo.CgroupPath)
+	defer cgroupManager.Destroy()
+	container.RecordEvent(containerInfo, container.EventStart)
+	if err := container.RunHooks(containerInfo.Hooks.Poststart, containerState(containerInfo, oci.StatusRunning)); err != nil {
+		log.Warnf("Poststart hook error %v", err)
 	}
 
-	if err := parent.Start(); err != nil {
-		log.Error(err)
+	if tty {
+		watchOOM(containerInfo)
+		parent.Wait()
+		container.RecordEvent(containerInfo, container.EventDie)
+		runPoststopHooks(containerInfo)
+		deleteContainerInfo(containerInfo.Name)
+		container.DeleteWorkSpace(containerInfo.Name)
 	}
+	return nil
+}
 
-	//record container info
-	containerName, err := recordContainerInfo(parent.Process.Pid, comArray, containerName, containerID, volume)
+// 启动容器的 init 进程, 配置好 cgroup、网络之后记录容器信息并把配置发给 init 进程
+// 调用者需要预先设置容器的 Id、Name 和 CgroupPath
+// 任何一步失败时结束 init 进程并撤销已经完成的步骤
+func startContainer(tty bool, comArray []string, res *subsystems.ResourceConfig, containerInfo *container.ContainerInfo,
+	envSlice []string, nw string) (_ *exec.Cmd, err error) {
+	undo := &rollback{}
+	defer func() {
+		if err != nil {
+			undo.run()
+		}
+	}()
+
+	nsPaths, err := sharedNamespacePaths(containerInfo)
 	if err != nil {
-		log.Errorf("Record container info error %v", err)
-		return
+		return nil, fmt.Errorf("Join namespaces error %v", err)
 	}
+	if containerInfo.Hostname == "" {
+		containerInfo.Hostname = containerInfo.Id
+	}
+	// init 进程总是按 Capabilities 收缩权限, exec 进程需要保持一致
+	if containerInfo.Capabilities == nil {
+		containerInfo.Capabilities = []string{}
+	}
+	containerInfo.CapabilitiesSet = true
 
-	// use containerID as cgroup name
-	cgroupManager := cgroups.NewCgroupManager(containerID)
-	defer cgroupManager.Destroy()
-	cgroupManager.Set(res)
-	cgroupManager.Apply(parent.Process.Pid)
+	// oci create 的状态目录由调用者创建和删除, 这里只删除 run 创建的状态目录
+	if containerInfo.Bundle == "" {
+		undo.add("container info", func() error {
+			deleteContainerInfo(containerInfo.Name)
+			return nil
+		})
+	}
+	// NewParentProcess 中途失败时也可能已经创建了部分 workspace
+	if containerInfo.Rootfs == "" {
+		undo.add("workspace", func() error {
+			container.DeleteWorkSpace(containerInfo.Name)
+			return nil
+		})
+	}
+	initCmd, writePipe := container.NewParentProcess(tty, containerInfo, envSlice)
+	if initCmd == nil {
+		return nil, fmt.Errorf("New parent process error")
+	}
+	// 交给 sendInitCommand 之后由它负责关闭, 撤销时不能再关闭一次
+	undo.add("init pipe", func() error {
+		if writePipe == nil {
+			return nil
+		}
+		return writePipe.Close()
+	})
+
+	// 先创建 cgroup 并设置资源限制, 撤销时在结束 init 进程之后才删除 cgroup
+	cgroupManager := cgroups.NewCgroupManager(containerInfo.CgroupPath)
+	undo.add("cgroup", cgroupManager.Destroy)
+	if err := cgroupManager.Set(res); err != nil {
+		return nil, fmt.Errorf("Set cgroup resources error %v", err)
+	}
+	containerInfo.Resources = res
+
+	if err := container.StartParentProcess(initCmd, nsPaths, containerInfo.TimeOffsets); err != nil {
+		return nil, err
+	}
+	undo.add("init process", func() error {
+		initCmd.Process.Kill()
+		// init 进程被杀掉时 Wait 返回的错误是预期的
+		initCmd.Wait()
+		return nil
+	})
+	if containerInfo.OomScoreAdj != 0 {
+		if err := container.SetOomScoreAdj(initCmd.Process.Pid, containerInfo.OomScoreAdj); err != nil {
+			return nil, fmt.Errorf("Set oom score adj error %v", err)
+		}
+	}
+	if err := cgroupManager.Apply(initCmd.Process.Pid); err != nil {
+		return nil, fmt.Errorf("Apply cgroup error %v", err)
+	}
 
 	if nw != "" {
 		// config container network
 		network.Init()
-		containerInfo := &container.ContainerInfo{
-			Id:          containerID,
-			Pid:         strconv.Itoa(parent.Process.Pid),
-			Name:        containerName,
-			PortMapping: portmapping,
+		netInfo := &container.ContainerInfo{
+			Id:          containerInfo.Id,
+			Pid:         strconv.Itoa(initCmd.Process.Pid),
+			Name:        containerInfo.Name,
+			PortMapping: containerInfo.PortMapping,
 		}
-		if err := network.Connect(nw, containerInfo); err != nil {
-			log.Errorf("Error Connect Network %v", err)
-			return
+		// Connect 失败时自己会释放 IP 和 veth
+		if err := network.Connect(nw, netInfo); err != nil {
+			return nil, fmt.Errorf("Error Connect Network %v", err)
 		}
+		undo.add("network", func() error {
+			return network.Disconnect(nw, netInfo)
+		})
+		containerInfo.IPAddress = netInfo.IPAddress
 	}
 
-	sendInitCommand(comArray, writePipe)
+	// hosts 中需要写入容器分配到的 IP, 所以在连接网络之后生成
+	hostFilesDir, err := container.SetupHostFiles(containerInfo)
+	if err != nil {
+		return nil, fmt.Errorf("Setup host files error %v", err)
+	}
 
-	if tty {
-		parent.Wait()
-		deleteContainerInfo(containerName)
-		container.DeleteWorkSpace(volume, containerName)
+	//record container info
+	if _, err := recordContainerInfo(initCmd.Process.Pid, comArray, containerInfo); err != nil {
+		return nil, fmt.Errorf("Record container info error %v", err)
 	}
 
+	// prestart hook 在网络配置完成之后、用户命令运行之前执行, 可以从 bundle 的 config.json 中读取容器的 IP 等信息
+	if err := container.RunHooks(containerInfo.Hooks.Prestart, containerState(containerInfo, oci.StatusCreated)); err != nil {
+		return nil, fmt.Errorf("Prestart hook error %v", err)
+	}
+
+	seccompProfile, err := container.LoadSeccompProfile(containerInfo.Seccomp)
+	if err != nil {
+		return nil, fmt.Errorf("Load seccomp profile error %v", err)
+	}
+
+	pipe := writePipe
+	writePipe = nil
+	if err := sendInitCommand(&container.InitConfig{
+		Args:            comArray,
+		Capabilities:    containerInfo.Capabilities,
+		Seccomp:         seccompProfile,
+		ReadonlyRootfs:  containerInfo.ReadonlyRootfs,
+		Tmpfs:           containerInfo.Tmpfs,
+		NoNewPrivileges: containerInfo.NoNewPrivileges,
+		MaskedPaths:     containerInfo.MaskedPaths,
+		ReadonlyPaths:   containerInfo.ReadonlyPaths,
+		ShmSize:         containerInfo.ShmSize,
+		Hostname:        initHostname(containerInfo),
+		HostFilesDir:    hostFilesDir,
+		User:            containerInfo.User,
+		WorkingDir:      containerInfo.WorkingDir,
+		Rlimits:         containerInfo.Ulimits,
+		CgroupNamespace: containerInfo.CgroupnsMode != container.NamespaceModeHost,
+		Sysctls:         containerInfo.Sysctls,
+		Devices:         containerInfo.Devices,
+		Mounts:          containerInfo.Mounts,
+		ExecFifo:        containerInfo.Bundle != "",
+	}, pipe); err != nil {
+		return nil, fmt.Errorf("Send init command error %v", err)
+	}
+	return initCmd, nil
 }
 
-func sendInitCommand(comArray []string, writePipe *os.File) {
-	command := strings.Join(comArray, " ")
-	log.Infof("command all is %s", command)
-	writePipe.WriteString(command)
-	writePipe.Close()
+// 解析 container:<name> 模式需要加入的 namespace 文件, 共享 namespace 时容器的主机名和 IP 也和对方相同
+// 模式是绝对路径时直接加入这个 namespace 文件
+func sharedNamespacePaths(containerInfo *container.ContainerInfo) ([]string, error) {
+	var nsPaths []string
+	modes := []struct {
+		mode string
+		ns   string
+	}{
+		{containerInfo.UtsMode, "uts"},
+		{containerInfo.PidMode, "pid"},
+		{containerInfo.NetMode, "net"},
+		{containerInfo.IpcMode, "ipc"},
+	}
+	for _, m := range modes {
+		if filepath.IsAbs(m.mode) {
+			nsPaths = append(nsPaths, m.mode)
+			continue
+		}
+		name := container.NamespaceContainer(m.mode)
+		if name == "" {
+			continue
+		}
+		target, err := getContainerInfoByName(name)
+		if err != nil {
+			return nil, err
+		}
+		if target.Status != container.RUNNING {
+			return nil, fmt.Errorf("container %s is not running", name)
+		}
+		nsPaths = append(nsPaths, fmt.Sprintf("/proc/%s/ns/%s", target.Pid, m.ns))
+		switch m.ns {
+		case "uts":
+			containerInfo.Hostname = target.Hostname
+		case "net":
+			containerInfo.IPAddress = target.IPAddress
+		}
+	}
+	if containerInfo.UtsMode == container.NamespaceModeHost {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, err
+		}
+		containerInfo.Hostname = hostname
+	}
+	return nsPaths, nil
+}
+
+// 传给 hook 的容器状态, mydocker run 创建的容器以状态目录作为 bundle, 其中的 config.json 记录了容器信息
+func containerState(containerInfo *container.ContainerInfo, status string) *container.State {
+	bundle := containerInfo.Bundle
+	if bundle == "" {
+		bundle = filepath.Clean(fmt.Sprintf(container.DefaultInfoLocation, containerInfo.Name))
+	}
+	state := &container.State{
+		Version:     oci.Version,
+		ID:          containerInfo.Id,
+		Status:      status,
+		Bundle:      bundle,
+		Annotations: containerInfo.Annotations,
+	}
+	if status != oci.StatusStopped {
+		state.Pid, _ = strconv.Atoi(containerInfo.Pid)
+	}
+	return state
+}
+
+// poststop hook 在容器被删除之后执行, 每个容器只执行一次, 失败时只记录日志
+func runPoststopHooks(containerInfo *container.ContainerInfo) {
+	if err := container.RunHooks(containerInfo.Hooks.Poststop, containerState(containerInfo, oci.StatusStopped)); err != nil {
+		log.Warnf("Poststop hook error %v", err)
+	}
+}
+
+// 只有在自己的 uts namespace 中才设置主机名, 否则会修改宿主机或者其他容器的主机名
+func initHostname(containerInfo *container.ContainerInfo) string {
+	if containerInfo.UtsMode != "" {
+		return ""
+	}
+	return containerInfo.Hostname
+}
+
+// 无论成功与否都会关闭 writePipe
+func sendInitCommand(config *container.InitConfig, writePipe *os.File) error {
+	log.Infof("command all is %s", strings.Join(config.Args, " "))
+	configBytes, err := json.Marshal(config)
+	if err != nil {
+		writePipe.Close()
+		return err
+	}
+	if _, err := writePipe.Write(configBytes); err != nil {
+		writePipe.Close()
+		return err
+	}
+	return writePipe.Close()
 }
 
-func recordContainerInfo(containerPID int, commandArray []string, containerName, id, volume string) (string, error) {
+func recordContainerInfo(containerPID int, commandArray []string, containerInfo *container.ContainerInfo) (string, error) {
 	createTime := time.Now().Format("2006-01-02 15:04:05")
 	command := strings.Join(commandArray, "")
-	containerInfo := &container.ContainerInfo{
-		Id:          id,
-		Pid:         strconv.Itoa(containerPID),
-		Command:     command,
-		CreatedTime: createTime,
-		Status:      container.RUNNING,
-		Name:        containerName,
-		Volume:      volume,
+	containerName := containerInfo.Name
+	containerInfo.Pid = strconv.Itoa(containerPID)
+	containerInfo.Command = command
+	containerInfo.CreatedTime = createTime
+	// oci create 创建的容器在 start 之前处于 created 状态
+	if containerInfo.Status == "" {
+		containerInfo.Status = container.RUNNING
 	}
 
 	jsonBytes, err := json.Marshal(containerInfo)
@@ -0,0 +1,375 @@
+package seccomp
+
+import (
+	"fmt"
+	"runtime"
+	"syscall"
+)
+
+const (
+	seccompModeFilter = 2
+
+	seccompRetKillThread  = 0x00000000
+	seccompRetKillProcess = 0x80000000
+	seccompRetTrap        = 0x00030000
+	seccompRetErrno       = 0x00050000
+	seccompRetTrace       = 0x7ff00000
+	seccompRetLog         = 0x7ffc0000
+	seccompRetAllow       = 0x7fff0000
+	seccompRetDataMask    = 0x0000ffff
+
+	auditArchX86     = 0x40000003
+	auditArchX86_64  = 0xc000003e
+	auditArchAARCH64 = 0xc00000b7
+
+	x32SyscallBit = 0x40000000
+
+	// struct seccomp_data 中各字段的偏移
+	offsetNr   = 0
+	offsetArch = 4
+	offsetArgs = 16
+
+	bpfMaxInstructions = 4096
+	bpfMaxJump         = 255
+	maxSyscallArgs     = 6
+)
+
+type archInfo struct {
+	audit    uint32
+	syscalls map[string]int
+}
+
+var archTable = map[Arch]archInfo{
+	ArchX86:     {auditArchX86, syscallsX86},
+	ArchX86_64:  {auditArchX86_64, syscallsX86_64},
+	ArchX32:     {auditArchX86_64, syscallsX32},
+	ArchAARCH64: {auditArchAARCH64, syscallsAarch64},
+}
+
+// 当前程序运行的架构
+func NativeArch() Arch {
+	switch runtime.GOARCH {
+	case "386":
+		return ArchX86
+	case "amd64":
+		return ArchX86_64
+	case "arm64":
+		return ArchAARCH64
+	}
+	return Arch(runtime.GOARCH)
+}
+
+// 把 seccomp 配置编译成 BPF 程序, caps 是容器拥有的 capability, 用于判断规则的 includes/excludes
+// 程序结构: 按 audit arch 分块, 每块内按规则顺序逐个匹配系统调用号和参数, 都不匹配时返回默认动作,
+// 不在配置中的架构直接杀死进程
+func Compile(profile *Seccomp, caps []string) ([]syscall.SockFilter, error) {
+	defaultRet, err := actionRet(profile.DefaultAction, profile.DefaultErrnoRet)
+	if err != nil {
+		return nil, err
+	}
+
+	// x32 与 x86_64 共用一个 audit arch, 需要放在同一个块里
+	var audits []uint32
+	blockArches := map[uint32][]Arch{}
+	for _, arch := range profileArches(profile) {
+		info, ok := archTable[arch]
+		if !ok {
+			continue
+		}
+		if _, exist := blockArches[info.audit]; !exist {
+			audits = append(audits, info.audit)
+		}
+		blockArches[info.audit] = append(blockArches[info.audit], arch)
+	}
+	if len(audits) == 0 {
+		return nil, fmt.Errorf("no supported architecture in seccomp profile")
+	}
+
+	prog := []syscall.SockFilter{stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, offsetArch)}
+	for _, audit := range audits {
+		block, err := compileArch(profile, blockArches[audit], caps, defaultRet)
+		if err != nil {
+			return nil, err
+		}
+		prog = append(prog,
+			jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, audit, 1, 0),
+			stmt(syscall.BPF_JMP|syscall.BPF_JA, uint32(len(block))))
+		prog = append(prog, block...)
+	}
+	prog = append(prog, stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKillThread))
+
+	if len(prog) > bpfMaxInstructions {
+		return nil, fmt.Errorf("seccomp filter too large: %d instructions", len(prog))
+	}
+	return prog, nil
+}
+
+func profileArches(profile *Seccomp) []Arch {
+	native := NativeArch()
+	for _, m := range profile.ArchMap {
+		if m.Arch == native {
+			return append([]Arch{m.Arch}, m.SubArches...)
+		}
+	}
+	if len(profile.Architectures) == 0 {
+		return []Arch{native}
+	}
+	return profile.Architectures
+}
+
+// 编译同一个 audit arch 下的规则, 块的入口和出口都保证累加器中是系统调用号
+func compileArch(profile *Seccomp, arches []Arch, caps []string, defaultRet uint32) ([]syscall.SockFilter, error) {
+	block := []syscall.SockFilter{stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, offsetNr)}
+
+	if archTable[arches[0]].audit == auditArchX86_64 {
+		hasX32, hasX86_64 := false, false
+		for _, arch := range arches {
+			hasX32 = hasX32 || arch == ArchX32
+			hasX86_64 = hasX86_64 || arch == ArchX86_64
+		}
+		// 没有允许的那一半调用号直接杀死, 防止通过 x32 调用号绕过过滤
+		if !hasX32 {
+			block = append(block,
+				jump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, x32SyscallBit, 0, 1),
+				stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKillThread))
+		}
+		if !hasX86_64 {
+			block = append(block,
+				jump(syscall.BPF_JMP|syscall.BPF_JGE|syscall.BPF_K, x32SyscallBit, 1, 0),
+				stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetKillThread))
+		}
+	}
+
+	for _, rule := range profile.Syscalls {
+		if !ruleEnabled(rule, caps) {
+			continue
+		}
+		ret, err := actionRet(rule.Action, rule.ErrnoRet)
+		if err != nil {
+			return nil, err
+		}
+		names := rule.Names
+		if rule.Name != "" {
+			names = append([]string{rule.Name}, names...)
+		}
+		var nrs []uint32
+		for _, name := range names {
+			for _, arch := range arches {
+				// 当前架构不存在的系统调用直接忽略
+				if nr, ok := archTable[arch].syscalls[name]; ok {
+					nrs = append(nrs, uint32(nr))
+				}
+			}
+		}
+		if len(nrs) == 0 {
+			continue
+		}
+
+		if len(rule.Args) == 0 {
+			block = append(block, compileSyscalls(nrs, ret)...)
+			continue
+		}
+		for _, nr := range nrs {
+			insts, err := compileSyscallWithArgs(nr, rule.Args, ret)
+			if err != nil {
+				return nil, fmt.Errorf("syscall %v: %v", names, err)
+			}
+			block = append(block, insts...)
+		}
+	}
+	return append(block, stmt(syscall.BPF_RET|syscall.BPF_K, defaultRet)), nil
+}
+
+func ruleEnabled(rule *Syscall, caps []string) bool {
+	for _, c := range rule.Includes.Caps {
+		if !contains(caps, c) {
+			return false
+		}
+	}
+	for _, c := range rule.Excludes.Caps {
+		if contains(caps, c) {
+			return false
+		}
+	}
+	if len(rule.Includes.Arches) > 0 && !contains(rule.Includes.Arches, runtime.GOARCH) {
+		return false
+	}
+	if contains(rule.Excludes.Arches, runtime.GOARCH) {
+		return false
+	}
+	return true
+}
+
+// 没有参数条件的规则: 任意一个调用号相等就返回动作
+func compileSyscalls(nrs []uint32, ret uint32) []syscall.SockFilter {
+	var insts []syscall.SockFilter
+	for len(nrs) > 0 {
+		n := len(nrs)
+		if n > bpfMaxJump-1 {
+			n = bpfMaxJump - 1
+		}
+		for i, nr := range nrs[:n] {
+			insts = append(insts, jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, uint8(n-i), 0))
+		}
+		insts = append(insts,
+			stmt(syscall.BPF_JMP|syscall.BPF_JA, 1),
+			stmt(syscall.BPF_RET|syscall.BPF_K, ret))
+		nrs = nrs[n:]
+	}
+	return insts
+}
+
+// 条件跳转的目标, failTarget 表示跳到规则末尾重新加载系统调用号
+type condInst struct {
+	inst   syscall.SockFilter
+	jtFail bool
+	jfFail bool
+}
+
+const failTarget = 0
+
+// 带参数条件的规则, 结构如下:
+//
+//	jeq nr, 0, len(body)+1
+//	body: 所有参数条件, 不满足时跳到 reload
+//	ret action
+//	reload: ld nr
+func compileSyscallWithArgs(nr uint32, args []*Arg, ret uint32) ([]syscall.SockFilter, error) {
+	var body []condInst
+	for _, arg := range args {
+		cond, err := compileArg(arg)
+		if err != nil {
+			return nil, err
+		}
+		body = append(body, cond...)
+	}
+	if len(body)+1 > bpfMaxJump {
+		return nil, fmt.Errorf("too many argument conditions")
+	}
+
+	insts := []syscall.SockFilter{jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, nr, 0, uint8(len(body)+1))}
+	for i, c := range body {
+		inst := c.inst
+		if c.jtFail {
+			inst.Jt = uint8(len(body) - i)
+		}
+		if c.jfFail {
+			inst.Jf = uint8(len(body) - i)
+		}
+		insts = append(insts, inst)
+	}
+	return append(insts,
+		stmt(syscall.BPF_RET|syscall.BPF_K, ret),
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, offsetNr)), nil
+}
+
+// 64 位参数分高低两个 32 位字比较, 条件满足时顺序执行到下一个条件
+func compileArg(arg *Arg) ([]condInst, error) {
+	if arg.Index >= maxSyscallArgs {
+		return nil, fmt.Errorf("invalid argument index %d", arg.Index)
+	}
+	lo := uint32(offsetArgs + 8*arg.Index)
+	hi := lo + 4
+	ldHi := condInst{inst: stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, hi)}
+	ldLo := condInst{inst: stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, lo)}
+	vHi, vLo := uint32(arg.Value>>32), uint32(arg.Value)
+	jeq := syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K
+	jgt := syscall.BPF_JMP | syscall.BPF_JGT | syscall.BPF_K
+	jge := syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K
+
+	switch arg.Op {
+	case OpEqualTo:
+		return []condInst{
+			ldHi,
+			{inst: jump(jeq, vHi, 0, failTarget), jfFail: true},
+			ldLo,
+			{inst: jump(jeq, vLo, 0, failTarget), jfFail: true},
+		}, nil
+	case OpNotEqual:
+		return []condInst{
+			ldHi,
+			{inst: jump(jeq, vHi, 0, 2)},
+			ldLo,
+			{inst: jump(jeq, vLo, failTarget, 0), jtFail: true},
+		}, nil
+	case OpGreaterThan, OpGreaterEqual:
+		loJump := jgt
+		if arg.Op == OpGreaterEqual {
+			loJump = jge
+		}
+		return []condInst{
+			ldHi,
+			{inst: jump(jgt, vHi, 3, 0)},
+			{inst: jump(jeq, vHi, 0, failTarget), jfFail: true},
+			ldLo,
+			{inst: jump(loJump, vLo, 0, failTarget), jfFail: true},
+		}, nil
+	case OpLessThan, OpLessEqual:
+		loJump := jge
+		if arg.Op == OpLessEqual {
+			loJump = jgt
+		}
+		return []condInst{
+			ldHi,
+			{inst: jump(jgt, vHi, failTarget, 0), jtFail: true},
+			{inst: jump(jeq, vHi, 0, 2)},
+			ldLo,
+			{inst: jump(loJump, vLo, failTarget, 0), jtFail: true},
+		}, nil
+	case OpMaskedEqual:
+		and := syscall.BPF_ALU | syscall.BPF_AND | syscall.BPF_K
+		return []condInst{
+			ldHi,
+			{inst: stmt(and, vHi)},
+			{inst: jump(jeq, uint32(arg.ValueTwo>>32), 0, failTarget), jfFail: true},
+			ldLo,
+			{inst: stmt(and, vLo)},
+			{inst: jump(jeq, uint32(arg.ValueTwo), 0, failTarget), jfFail: true},
+		}, nil
+	}
+	return nil, fmt.Errorf("unknown operator %s", arg.Op)
+}
+
+func actionRet(action Action, errnoRet *uint) (uint32, error) {
+	data := uint32(0)
+	if errnoRet != nil {
+		data = uint32(*errnoRet) & seccompRetDataMask
+	}
+	switch action {
+	case ActKill, ActKillThread:
+		return seccompRetKillThread, nil
+	case ActKillProcess:
+		return seccompRetKillProcess, nil
+	case ActTrap:
+		return seccompRetTrap, nil
+	case ActErrno:
+		if errnoRet == nil {
+			data = uint32(syscall.EPERM)
+		}
+		return seccompRetErrno | data, nil
+	case ActTrace:
+		return seccompRetTrace | data, nil
+	case ActLog:
+		return seccompRetLog, nil
+	case ActAllow:
+		return seccompRetAllow, nil
+	}
+	return 0, fmt.Errorf("unknown seccomp action %s", action)
+}
+
+func stmt(code int, k uint32) syscall.SockFilter {
+	return syscall.SockFilter{Code: uint16(code), K: k}
+}
+
+func jump(code int, k uint32, jt, jf uint8) syscall.SockFilter {
+	return syscall.SockFilter{Code: uint16(code), Jt: jt, Jf: jf, K: k}
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
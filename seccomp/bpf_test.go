@@ -0,0 +1,171 @@
+package seccomp
+
+import (
+	"encoding/binary"
+	"syscall"
+	"testing"
+)
+
+// 在测试中模拟执行 BPF 程序
+func runFilter(t *testing.T, prog []syscall.SockFilter, arch uint32, nr int, args ...uint64) uint32 {
+	data := make([]byte, 64)
+	binary.LittleEndian.PutUint32(data[offsetNr:], uint32(nr))
+	binary.LittleEndian.PutUint32(data[offsetArch:], arch)
+	for i, arg := range args {
+		binary.LittleEndian.PutUint64(data[offsetArgs+8*i:], arg)
+	}
+	var acc uint32
+	for pc := 0; pc < len(prog); pc++ {
+		inst := prog[pc]
+		switch int(inst.Code) {
+		case syscall.BPF_LD | syscall.BPF_W | syscall.BPF_ABS:
+			acc = binary.LittleEndian.Uint32(data[inst.K:])
+		case syscall.BPF_ALU | syscall.BPF_AND | syscall.BPF_K:
+			acc &= inst.K
+		case syscall.BPF_JMP | syscall.BPF_JA:
+			pc += int(inst.K)
+		case syscall.BPF_JMP | syscall.BPF_JEQ | syscall.BPF_K:
+			pc += condJump(acc == inst.K, inst)
+		case syscall.BPF_JMP | syscall.BPF_JGT | syscall.BPF_K:
+			pc += condJump(acc > inst.K, inst)
+		case syscall.BPF_JMP | syscall.BPF_JGE | syscall.BPF_K:
+			pc += condJump(acc >= inst.K, inst)
+		case syscall.BPF_RET | syscall.BPF_K:
+			return inst.K
+		default:
+			t.Fatalf("unknown instruction %+v", inst)
+		}
+	}
+	t.Fatalf("filter fell through")
+	return 0
+}
+
+func condJump(cond bool, inst syscall.SockFilter) int {
+	if cond {
+		return int(inst.Jt)
+	}
+	return int(inst.Jf)
+}
+
+func TestCompileDefaultProfile(t *testing.T) {
+	if NativeArch() != ArchX86_64 {
+		t.Skip("default profile test only runs on x86_64")
+	}
+	prog, err := Compile(DefaultProfile(), []string{"CAP_CHOWN"})
+	if err != nil {
+		t.Fatalf("compile default profile %v", err)
+	}
+	eperm := uint32(seccompRetErrno | 1)
+	cases := []struct {
+		arch uint32
+		nr   int
+		args []uint64
+		want uint32
+	}{
+		{auditArchX86_64, syscallsX86_64["read"], nil, seccompRetAllow},
+		{auditArchX86_64, syscallsX86_64["kexec_load"], nil, eperm},
+		{auditArchX86_64, syscallsX86_64["mount"], nil, eperm},
+		{auditArchX86_64, syscallsX86_64["ptrace"], nil, eperm},
+		{auditArchX86, syscallsX86["keyctl"], nil, eperm},
+		{auditArchX86_64, syscallsX32["keyctl"], nil, eperm},
+		{auditArchX86_64, syscallsX86_64["personality"], []uint64{0x8}, seccompRetAllow},
+		{auditArchX86_64, syscallsX86_64["personality"], []uint64{0x1}, eperm},
+		{auditArchAARCH64, 0, nil, seccompRetKillThread},
+	}
+	for _, c := range cases {
+		if got := runFilter(t, prog, c.arch, c.nr, c.args...); got != c.want {
+			t.Errorf("arch %#x nr %d args %v: got %#x want %#x", c.arch, c.nr, c.args, got, c.want)
+		}
+	}
+
+	prog, _ = Compile(DefaultProfile(), []string{"CAP_SYS_ADMIN"})
+	if got := runFilter(t, prog, auditArchX86_64, syscallsX86_64["mount"]); got != seccompRetAllow {
+		t.Errorf("mount should be allowed with CAP_SYS_ADMIN, got %#x", got)
+	}
+}
+
+func TestDefaultProfileClone(t *testing.T) {
+	if NativeArch() != ArchX86_64 {
+		t.Skip("default profile test only runs on x86_64")
+	}
+	prog, err := Compile(DefaultProfile(), []string{"CAP_CHOWN"})
+	if err != nil {
+		t.Fatalf("compile default profile %v", err)
+	}
+	eperm := uint32(seccompRetErrno | 1)
+	enosys := uint32(seccompRetErrno | uint32(syscall.ENOSYS))
+	forkFlags := uint64(syscall.CLONE_VM | syscall.CLONE_FS | syscall.CLONE_FILES | syscall.CLONE_SIGHAND | syscall.CLONE_THREAD | uint64(syscall.SIGCHLD))
+	cases := []struct {
+		arch uint32
+		nr   int
+		args []uint64
+		want uint32
+	}{
+		{auditArchX86_64, syscallsX86_64["clone"], []uint64{forkFlags}, seccompRetAllow},
+		{auditArchX86_64, syscallsX86_64["clone"], []uint64{syscall.CLONE_NEWUSER | syscall.CLONE_NEWNS | uint64(syscall.SIGCHLD)}, eperm},
+		{auditArchX86_64, syscallsX86_64["clone"], []uint64{syscall.CLONE_NEWNET}, eperm},
+		{auditArchX86, syscallsX86["clone"], []uint64{syscall.CLONE_NEWPID}, eperm},
+		{auditArchX86_64, syscallsX86_64["clone3"], nil, enosys},
+	}
+	for _, c := range cases {
+		if got := runFilter(t, prog, c.arch, c.nr, c.args...); got != c.want {
+			t.Errorf("arch %#x nr %d args %v: got %#x want %#x", c.arch, c.nr, c.args, got, c.want)
+		}
+	}
+
+	prog, _ = Compile(DefaultProfile(), []string{"CAP_SYS_ADMIN"})
+	if got := runFilter(t, prog, auditArchX86_64, syscallsX86_64["clone"], syscall.CLONE_NEWUSER); got != seccompRetAllow {
+		t.Errorf("clone with namespace flags should be allowed with CAP_SYS_ADMIN, got %#x", got)
+	}
+	if got := runFilter(t, prog, auditArchX86_64, syscallsX86_64["clone3"]); got != seccompRetAllow {
+		t.Errorf("clone3 should be allowed with CAP_SYS_ADMIN, got %#x", got)
+	}
+}
+
+func TestCompileArgs(t *testing.T) {
+	profile := &Seccomp{
+		DefaultAction: ActKill,
+		Architectures: []Arch{NativeArch()},
+		Syscalls: []*Syscall{
+			{Names: []string{"write"}, Action: ActAllow, Args: []*Arg{{Index: 0, Value: 1 << 32, Op: OpGreaterEqual}, {Index: 1, Value: 10, Op: OpLessThan}}},
+			{Names: []string{"read"}, Action: ActAllow, Args: []*Arg{{Index: 2, Value: 0xf0, ValueTwo: 0x30, Op: OpMaskedEqual}}},
+			{Name: "close", Action: ActErrno},
+		},
+	}
+	prog, err := Compile(profile, nil)
+	if err != nil {
+		t.Fatalf("compile profile %v", err)
+	}
+	audit := archTable[NativeArch()].audit
+	nrs := archTable[NativeArch()].syscalls
+	cases := []struct {
+		nr   int
+		args []uint64
+		want uint32
+	}{
+		{nrs["write"], []uint64{1 << 32, 9}, seccompRetAllow},
+		{nrs["write"], []uint64{1<<32 - 1, 9}, seccompRetKillThread},
+		{nrs["write"], []uint64{1 << 33, 10}, seccompRetKillThread},
+		{nrs["read"], []uint64{0, 0, 0x3f}, seccompRetAllow},
+		{nrs["read"], []uint64{0, 0, 0x4f}, seccompRetKillThread},
+		{nrs["close"], nil, seccompRetErrno | 1},
+		{nrs["open"], nil, seccompRetKillThread},
+	}
+	for _, c := range cases {
+		if got := runFilter(t, prog, audit, c.nr, c.args...); got != c.want {
+			t.Errorf("nr %d args %v: got %#x want %#x", c.nr, c.args, got, c.want)
+		}
+	}
+}
+
+func TestEncodeFilter(t *testing.T) {
+	filter := []syscall.SockFilter{
+		stmt(syscall.BPF_LD|syscall.BPF_W|syscall.BPF_ABS, 4),
+		jump(syscall.BPF_JMP|syscall.BPF_JEQ|syscall.BPF_K, 0xc000003e, 1, 0),
+		stmt(syscall.BPF_RET|syscall.BPF_K, seccompRetAllow),
+	}
+	want := "0020000000000004" + "00150100c000003e" + "000600007fff0000"
+	if got := EncodeFilter(filter); got != want {
+		t.Errorf("encode filter got %s, want %s", got, want)
+	}
+}
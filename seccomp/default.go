@@ -0,0 +1,97 @@
+package seccomp
+
+import (
+	"syscall"
+)
+
+// 创建新 namespace 的 clone 标志, CLONE_NEWTIME 和 CSIGNAL 重叠, docker 也没有包含
+const cloneNamespaceFlags = syscall.CLONE_NEWNS | syscall.CLONE_NEWUTS | syscall.CLONE_NEWIPC |
+	syscall.CLONE_NEWUSER | syscall.CLONE_NEWPID | syscall.CLONE_NEWNET | syscall.CLONE_NEWCGROUP
+
+func errnoRet(errno uint) *uint {
+	return &errno
+}
+
+// 内置的默认配置: 放行大部分系统调用, 禁止 docker 默认配置中屏蔽的危险调用,
+// 其中一部分在容器拥有对应 capability 时放行
+func DefaultProfile() *Seccomp {
+	eperm := errnoRet(1)
+	return &Seccomp{
+		DefaultAction: ActAllow,
+		ArchMap: []Architecture{
+			{Arch: ArchX86_64, SubArches: []Arch{ArchX86, ArchX32}},
+			{Arch: ArchAARCH64},
+		},
+		Syscalls: []*Syscall{
+			{
+				Names: []string{
+					"acct", "add_key", "bpf", "clock_adjtime", "clock_settime", "create_module",
+					"delete_module", "finit_module", "get_kernel_syms", "init_module", "ioperm",
+					"iopl", "kexec_file_load", "kexec_load", "keyctl", "lookup_dcookie",
+					"nfsservctl", "open_by_handle_at", "perf_event_open", "query_module",
+					"reboot", "request_key", "settimeofday", "stime", "swapoff", "swapon",
+					"_sysctl", "sysfs", "uselib", "userfaultfd", "ustat", "vm86", "vm86old",
+				},
+				Action:   ActErrno,
+				ErrnoRet: eperm,
+			},
+			{
+				Names: []string{
+					"mount", "umount", "umount2", "pivot_root", "setns", "unshare",
+					"name_to_handle_at", "quotactl", "fsopen", "fsmount", "fsconfig",
+					"fspick", "move_mount", "open_tree", "mount_setattr",
+				},
+				Action:   ActErrno,
+				ErrnoRet: eperm,
+				Excludes: Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				// 没有 CAP_SYS_ADMIN 时 clone 不能创建新的 namespace, 否则可以绕过对 unshare 的限制
+				Names:  []string{"clone"},
+				Action: ActAllow,
+				Args: []*Arg{
+					{Index: 0, Value: cloneNamespaceFlags, ValueTwo: 0, Op: OpMaskedEqual},
+				},
+				Excludes: Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				Names:    []string{"clone"},
+				Action:   ActErrno,
+				ErrnoRet: eperm,
+				Excludes: Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				// clone3 的标志在用户内存的结构体中, seccomp 无法检查, 返回 ENOSYS 让 libc 回退到 clone
+				Names:    []string{"clone3"},
+				Action:   ActErrno,
+				ErrnoRet: errnoRet(uint(syscall.ENOSYS)),
+				Excludes: Filter{Caps: []string{"CAP_SYS_ADMIN"}},
+			},
+			{
+				Names:    []string{"ptrace", "process_vm_readv", "process_vm_writev", "kcmp"},
+				Action:   ActErrno,
+				ErrnoRet: eperm,
+				Excludes: Filter{Caps: []string{"CAP_SYS_PTRACE"}},
+			},
+			{
+				Names:    []string{"get_mempolicy", "mbind", "set_mempolicy", "move_pages"},
+				Action:   ActErrno,
+				ErrnoRet: eperm,
+				Excludes: Filter{Caps: []string{"CAP_SYS_NICE"}},
+			},
+			{
+				// 只允许切换到 PER_LINUX 和 PER_LINUX32 等常用 personality
+				Names:  []string{"personality"},
+				Action: ActErrno,
+				Args: []*Arg{
+					{Index: 0, Value: 0x0, Op: OpNotEqual},
+					{Index: 0, Value: 0x8, Op: OpNotEqual},
+					{Index: 0, Value: 0x20000, Op: OpNotEqual},
+					{Index: 0, Value: 0x20008, Op: OpNotEqual},
+					{Index: 0, Value: 0xffffffff, Op: OpNotEqual},
+				},
+				ErrnoRet: eperm,
+			},
+		},
+	}
+}
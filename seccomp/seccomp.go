@@ -0,0 +1,112 @@
+package seccomp
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"syscall"
+	"unsafe"
+)
+
+type Action string
+type Operator string
+type Arch string
+
+const (
+	ActKill        Action = "SCMP_ACT_KILL"
+	ActKillThread  Action = "SCMP_ACT_KILL_THREAD"
+	ActKillProcess Action = "SCMP_ACT_KILL_PROCESS"
+	ActTrap        Action = "SCMP_ACT_TRAP"
+	ActErrno       Action = "SCMP_ACT_ERRNO"
+	ActTrace       Action = "SCMP_ACT_TRACE"
+	ActLog         Action = "SCMP_ACT_LOG"
+	ActAllow       Action = "SCMP_ACT_ALLOW"
+
+	OpNotEqual     Operator = "SCMP_CMP_NE"
+	OpLessThan     Operator = "SCMP_CMP_LT"
+	OpLessEqual    Operator = "SCMP_CMP_LE"
+	OpEqualTo      Operator = "SCMP_CMP_EQ"
+	OpGreaterEqual Operator = "SCMP_CMP_GE"
+	OpGreaterThan  Operator = "SCMP_CMP_GT"
+	OpMaskedEqual  Operator = "SCMP_CMP_MASKED_EQ"
+
+	ArchX86     Arch = "SCMP_ARCH_X86"
+	ArchX86_64  Arch = "SCMP_ARCH_X86_64"
+	ArchX32     Arch = "SCMP_ARCH_X32"
+	ArchAARCH64 Arch = "SCMP_ARCH_AARCH64"
+)
+
+// 与 docker 兼容的 seccomp 配置文件格式
+type Seccomp struct {
+	DefaultAction   Action         `json:"defaultAction"`
+	DefaultErrnoRet *uint          `json:"defaultErrnoRet,omitempty"`
+	Architectures   []Arch         `json:"architectures,omitempty"`
+	ArchMap         []Architecture `json:"archMap,omitempty"`
+	Syscalls        []*Syscall     `json:"syscalls"`
+}
+
+type Architecture struct {
+	Arch      Arch   `json:"architecture"`
+	SubArches []Arch `json:"subArchitectures"`
+}
+
+// 系统调用参数的比较条件, MASKED_EQ 时 Value 为掩码, ValueTwo 为期望值
+type Arg struct {
+	Index    uint     `json:"index"`
+	Value    uint64   `json:"value"`
+	ValueTwo uint64   `json:"valueTwo"`
+	Op       Operator `json:"op"`
+}
+
+// 规则生效的条件, Caps 为容器需要拥有的 capability, Arches 为宿主机的架构(GOARCH)
+type Filter struct {
+	Caps   []string `json:"caps,omitempty"`
+	Arches []string `json:"arches,omitempty"`
+}
+
+type Syscall struct {
+	Name     string   `json:"name,omitempty"`
+	Names    []string `json:"names,omitempty"`
+	Action   Action   `json:"action"`
+	ErrnoRet *uint    `json:"errnoRet,omitempty"`
+	Args     []*Arg   `json:"args"`
+	Includes Filter   `json:"includes"`
+	Excludes Filter   `json:"excludes"`
+}
+
+func LoadProfile(path string) (*Seccomp, error) {
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read seccomp profile %s error %v", path, err)
+	}
+	var profile Seccomp
+	if err := json.Unmarshal(content, &profile); err != nil {
+		return nil, fmt.Errorf("decode seccomp profile %s error %v", path, err)
+	}
+	return &profile, nil
+}
+
+// 为当前线程安装 seccomp 过滤器, 调用者需要拥有 CAP_SYS_ADMIN 或者已经设置了 no_new_privs
+func InstallFilter(filter []syscall.SockFilter) error {
+	if len(filter) == 0 {
+		return nil
+	}
+	prog := syscall.SockFprog{
+		Len:    uint16(len(filter)),
+		Filter: &filter[0],
+	}
+	if _, _, errno := syscall.RawSyscall(syscall.SYS_PRCTL, syscall.PR_SET_SECCOMP, seccompModeFilter, uintptr(unsafe.Pointer(&prog))); errno != 0 {
+		return fmt.Errorf("prctl PR_SET_SECCOMP error %v", errno)
+	}
+	return nil
+}
+
+// 把过滤器编码成十六进制字符串, 每条指令 16 个字符: code(4) jt(2) jf(2) k(8), 通过环境变量传给 nsenter
+func EncodeFilter(filter []syscall.SockFilter) string {
+	var buf bytes.Buffer
+	for _, inst := range filter {
+		fmt.Fprintf(&buf, "%04x%02x%02x%08x", inst.Code, inst.Jt, inst.Jf, inst.K)
+	}
+	return buf.String()
+}
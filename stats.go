@@ -0,0 +1,142 @@
+package main
+
+import (
+	"fmt"
+	log "github.com/Sirupsen/logrus"
+	"github.com/xianlubird/mydocker/cgroups"
+	"github.com/xianlubird/mydocker/cgroups/subsystems"
+	"github.com/xianlubird/mydocker/container"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// 打印容器的资源使用情况, 没有指定容器时打印所有运行中的容器
+func statsContainers(names []string) error {
+	var containers []*container.ContainerInfo
+	if len(names) == 0 {
+		dirURL := fmt.Sprintf(container.DefaultInfoLocation, "")
+		files, err := ioutil.ReadDir(dirURL[:len(dirURL)-1])
+		if err != nil {
+			return fmt.Errorf("Read dir %s error %v", dirURL, err)
+		}
+		for _, file := range files {
+			if file.Name() == "network" || !file.IsDir() {
+				continue
+			}
+			containerInfo, err := getContainerInfo(file)
+			if err != nil || !containerRunning(containerInfo) {
+				continue
+			}
+			containers = append(containers, containerInfo)
+		}
+	}
+	for _, name := range names {
+		containerInfo, err := getContainerInfoByName(name)
+		if err != nil {
+			return fmt.Errorf("Get container %s info error %v", name, err)
+		}
+		if !containerRunning(containerInfo) {
+			return fmt.Errorf("container %s is not running", name)
+		}
+		containers = append(containers, containerInfo)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 12, 1, 3, ' ', 0)
+	fmt.Fprint(w, "ID\tNAME\tPIDS\tPIDS PEAK\tPIDS LIMIT\tCPU THROTTLED\tBLOCK I/O\tHUGETLB\n")
+	for _, item := range containers {
+		stats, err := containerStats(item)
+		if err != nil {
+			log.Errorf("Get container %s stats error %v", item.Name, err)
+			continue
+		}
+		pids := &subsystems.PidsStats{}
+		if stats.Pids != nil {
+			pids = stats.Pids
+		}
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%s\t%s\t%s\t%s\n",
+			item.Id,
+			item.Name,
+			pids.Current,
+			pids.Peak,
+			formatLimit(pids.Limit),
+			formatThrottled(stats.Cpu),
+			formatBlkio(stats.Blkio),
+			formatHugetlb(stats.Hugetlb))
+	}
+	return w.Flush()
+}
+
+// 容器进程还存在并且有自己的 cgroup 时才能统计资源使用情况
+func containerRunning(containerInfo *container.ContainerInfo) bool {
+	pid, err := strconv.Atoi(containerInfo.Pid)
+	return err == nil && pid > 0 && processAlive(pid) && containerInfo.CgroupPath != ""
+}
+
+func containerStats(containerInfo *container.ContainerInfo) (*subsystems.Stats, error) {
+	return cgroups.NewCgroupManager(containerInfo.CgroupPath).GetStats()
+}
+
+func formatLimit(limit uint64) string {
+	if limit == 0 {
+		return "max"
+	}
+	return strconv.FormatUint(limit, 10)
+}
+
+// 显示为 "被限流的周期数/总周期数 限流时间"
+func formatThrottled(cpu *subsystems.CpuStats) string {
+	if cpu == nil {
+		return "-"
+	}
+	throttled := time.Duration(cpu.ThrottledTime).Round(time.Millisecond)
+	return fmt.Sprintf("%d/%d %s", cpu.NrThrottled, cpu.NrPeriods, throttled)
+}
+
+// 每个设备显示为 "major:minor 读取/写入"
+func formatBlkio(blkio *subsystems.BlkioStats) string {
+	if blkio == nil || len(blkio.Devices) == 0 {
+		return "-"
+	}
+	var devices []string
+	for _, d := range blkio.Devices {
+		devices = append(devices, fmt.Sprintf("%d:%d %s/%s", d.Major, d.Minor, formatBytes(d.ReadBytes), formatBytes(d.WriteBytes)))
+	}
+	return strings.Join(devices, ", ")
+}
+
+// 只显示有用量或者设置了限制的大页, 每种显示为 "大小 用量/限制"
+func formatHugetlb(hugetlb map[string]subsystems.HugetlbStats) string {
+	var sizes []string
+	for size, h := range hugetlb {
+		if h.Usage == 0 && h.Limit == 0 {
+			continue
+		}
+		limit := "max"
+		if h.Limit != 0 {
+			limit = formatBytes(h.Limit)
+		}
+		sizes = append(sizes, fmt.Sprintf("%s %s/%s", size, formatBytes(h.Usage), limit))
+	}
+	if len(sizes) == 0 {
+		return "-"
+	}
+	sort.Strings(sizes)
+	return strings.Join(sizes, ", ")
+}
+
+func formatBytes(size uint64) string {
+	units := []string{"B", "KiB", "MiB", "GiB", "TiB"}
+	value, i := float64(size), 0
+	for ; value >= 1024 && i < len(units)-1; i++ {
+		value /= 1024
+	}
+	if i == 0 {
+		return fmt.Sprintf("%d%s", size, units[0])
+	}
+	return fmt.Sprintf("%.1f%s", value, units[i])
+}
@@ -31,6 +31,7 @@ func stopContainer(containerName string) {
 		log.Errorf("Get container %s info error %v", containerName, err)
 		return
 	}
+	refreshOOMKilled(containerInfo)
 	containerInfo.Status = container.STOP
 	containerInfo.Pid = " "
 	newContentBytes, err := json.Marshal(containerInfo)
@@ -43,6 +44,8 @@ func stopContainer(containerName string) {
 	if err := ioutil.WriteFile(configFilePath, newContentBytes, 0622); err != nil {
 		log.Errorf("Write file %s error", configFilePath, err)
 	}
+	// poststop hook 在删除容器时执行, 前台运行的容器由 Run 删除, 后台运行的容器由 rm 删除
+	container.RecordEvent(containerInfo, container.EventStop)
 }
 
 func getContainerInfoByName(containerName string) (*container.ContainerInfo, error) {
@@ -76,5 +79,10 @@ func removeContainer(containerName string) {
 		log.Errorf("Remove file %s error %v", dirURL, err)
 		return
 	}
-	container.DeleteWorkSpace(containerInfo.Volume, containerName)
+	// oci create 创建的容器使用 bundle 中的 rootfs, 没有 aufs 工作目录
+	if containerInfo.Rootfs == "" {
+		container.DeleteWorkSpace(containerName)
+	}
+	container.RecordEvent(containerInfo, container.EventDestroy)
+	runPoststopHooks(containerInfo)
 }
@@ -0,0 +1,73 @@
+package main
+
+import (
+	"fmt"
+	"github.com/xianlubird/mydocker/cgroups"
+	"github.com/xianlubird/mydocker/cgroups/subsystems"
+	"github.com/xianlubird/mydocker/container"
+)
+
+// 修改运行中容器的资源限制, cgroup 中只写入这次修改的限制, 成功后把合并后的配置保存到容器信息中
+func updateContainer(containerName string, update *subsystems.ResourceConfig) error {
+	containerInfo, err := getContainerInfoByName(containerName)
+	if err != nil {
+		return fmt.Errorf("Get container %s info error %v", containerName, err)
+	}
+	if !containerRunning(containerInfo) {
+		return fmt.Errorf("container %s is not running", containerName)
+	}
+	res := &subsystems.ResourceConfig{}
+	if containerInfo.Resources != nil {
+		merged := *containerInfo.Resources
+		res = &merged
+	}
+	mergeResources(res, update)
+	if err := res.Validate(); err != nil {
+		return err
+	}
+	if update.MemoryLimit != 0 {
+		usage, err := subsystems.MemoryUsage(containerInfo.CgroupPath)
+		if err != nil {
+			return fmt.Errorf("Get container %s memory usage error %v", containerName, err)
+		}
+		if uint64(update.MemoryLimit) < usage {
+			return fmt.Errorf("memory limit %s is below current usage %s", formatBytes(uint64(update.MemoryLimit)), formatBytes(usage))
+		}
+		// 和 swap 一起写入, v1 中会按照 memsw 不小于 limit 的顺序写入两个文件
+		update.MemorySwap = res.MemorySwap
+	}
+	if err := cgroups.NewCgroupManager(containerInfo.CgroupPath).Set(update); err != nil {
+		return err
+	}
+	containerInfo.Resources = res
+	if err := saveContainerInfo(containerInfo); err != nil {
+		return fmt.Errorf("Save container %s info error %v", containerName, err)
+	}
+	container.RecordEvent(containerInfo, container.EventUpdate)
+	return nil
+}
+
+// update 支持修改的限制中, 非零值覆盖原来的配置
+func mergeResources(res, update *subsystems.ResourceConfig) {
+	if update.MemoryLimit != 0 {
+		res.MemoryLimit = update.MemoryLimit
+	}
+	if update.CpuShare != 0 {
+		res.CpuShare = update.CpuShare
+	}
+	if len(update.CpuSet) > 0 {
+		res.CpuSet = update.CpuSet
+	}
+	if len(update.CpusetMems) > 0 {
+		res.CpusetMems = update.CpusetMems
+	}
+	if update.CpuPeriod != 0 || update.CpuQuota != 0 {
+		res.CpuPeriod, res.CpuQuota = update.CpuPeriod, update.CpuQuota
+	}
+	if update.PidsLimit != 0 {
+		res.PidsLimit = update.PidsLimit
+	}
+	if update.BlkioWeight != 0 {
+		res.BlkioWeight = update.BlkioWeight
+	}
+}